@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/entitlements"
+)
+
+// Chirpy Red members get perks when they post chirps:
+// longer chirps, editing, scheduled chirps and a higher rate limit.
+// What each plan allows is configured in cfg.plans.
+
+// The rate limit counts the chirps of this window
+const chirpRateWindow = time.Hour
+
+// planFor returns what the user's plan allows.
+func (cfg *apiConfig) planFor(user database.User) entitlements.Plan {
+	if user.IsChirpyRed {
+		return cfg.plans.Get(entitlements.PlanRed)
+	}
+	return cfg.plans.Get(entitlements.PlanFree)
+}
+
+// checkChirpRate reports whether the user may post another chirp.
+// If not, it responds with a 429 status code.
+func (cfg *apiConfig) checkChirpRate(w http.ResponseWriter, r *http.Request, user database.User, plan entitlements.Plan) bool {
+	count, err := cfg.DB.CountRecentChirps(r.Context(), database.CountRecentChirpsParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC().Add(-chirpRateWindow),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count chirps", err)
+		return false
+	}
+	if int(count) >= plan.ChirpsPerHour {
+		w.Header().Set("Retry-After", fmt.Sprint(int(chirpRateWindow.Seconds())))
+		respondWithError(w, http.StatusTooManyRequests, "Too many chirps, try again later", nil)
+		return false
+	}
+	return true
+}
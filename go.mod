@@ -2,11 +2,12 @@ module github.com/Bayan2019/go-http-server
 
 go 1.23.2
 
-require golang.org/x/crypto v0.28.0
-
 require (
-	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/google/uuid v1.6.0
+	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.28.0
 )
+
+require golang.org/x/sys v0.26.0 // indirect
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Moderation endpoints, only allowed for users with the admin role.
+
+// GET /admin/users lists all users.
+func (cfg *apiConfig) handlerAdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	dbUsers, err := cfg.DB.GetUsers(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get users", err)
+		return
+	}
+
+	users := []User{}
+	for _, dbUser := range dbUsers {
+		users = append(users, databaseUserToUser(dbUser))
+	}
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// PUT /admin/users/{userID}/roles replaces the roles of a user.
+// The new roles are carried by the user's next access token.
+func (cfg *apiConfig) handlerAdminUpdateUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	type parameters struct {
+		Roles []string `json:"roles"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Roles == nil {
+		params.Roles = []string{}
+	}
+
+	user, err := cfg.DB.UpdateUserRoles(r.Context(), database.UpdateUserRolesParams{
+		ID:    userID,
+		Roles: params.Roles,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Couldn't find user", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(user))
+}
+
+// DELETE /admin/chirps/{chirpID} deletes any chirp,
+// whoever is its author.
+func (cfg *apiConfig) handlerAdminDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp", err)
+		return
+	}
+
+	err = cfg.DB.DeleteChirp(r.Context(), dbChirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Chirp is not deleted", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /admin/users/{userID}/unlock lifts the lockout of an account
+// after too many failed logins.
+func (cfg *apiConfig) handlerAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	user, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Couldn't find user", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	err = cfg.DB.ResetLoginThrottle(r.Context(), accountThrottleKey(user.Email))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlock user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
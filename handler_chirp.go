@@ -1,20 +1,25 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
-
-	// "time"
+	"time"
 
 	// "github.com/Bayan2019/rss_blog/internal/auth"
-	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/chirpfilter"
 	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/pagination"
 	"github.com/google/uuid"
 )
 
+// How long the URL of the media of a chirp may be
+const maxMediaURLLength = 2048
+
 func (apiCfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 
 	// It accepts a JSON payload with a body field:
@@ -22,45 +27,94 @@ func (apiCfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Reque
 		Body string `json:"body"`
 		// It is not an authenticated endpoint
 		// User uuid.UUID `json:"user_id"`
+		// Post the chirp later (Chirpy Red)
+		PublishAt *time.Time `json:"publish_at"`
+		// The chirp it replies to
+		ParentID *uuid.UUID `json:"parent_id"`
+		// URL of an image or video (hosted elsewhere)
+		MediaURL *string `json:"media_url"`
 	}
 
 	// To post a chirp, a user needs to have valid JWT
-	// Use your GetBearerToken
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	// Use your ValidateJWT
-	userID, err := auth.ValidateJWT(token, apiCfg.jwtSecret)
-	if err != nil {
-		// If the JWT is invalid, return a 401 Unauthorized response
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	// (checked by middlewareAuth)
+	user, _ := userFromContext(r.Context())
+	if apiCfg.requireVerifiedEmail && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Email is not verified", nil)
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON: %s", err), err)
 		return
 	}
 
+	// The user's plan sets how long chirps may be and how many may be posted
+	plan := apiCfg.planFor(user)
+
 	// Delete the /api/validate_chirp endpoint that we created before,
 	// but port all that logic into this one.
 	// Users should not be allowed to create invalid chirps!
-	cleaned, err := validateChirp(params.Body)
+	cleaned, err := validateChirp(params.Body, plan.MaxChirpLength)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
+	mediaURL := sql.NullString{}
+	if params.MediaURL != nil {
+		err := validateMediaURL(*params.MediaURL)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		mediaURL = sql.NullString{String: *params.MediaURL, Valid: true}
+	}
+	if !apiCfg.checkChirpRate(w, r, user, plan) {
+		return
+	}
+
+	parentID := uuid.NullUUID{}
+	if params.ParentID != nil {
+		if params.PublishAt != nil {
+			respondWithError(w, http.StatusBadRequest, "Replies can't be scheduled", nil)
+			return
+		}
+		parent, err := apiCfg.DB.GetChirp(r.Context(), *params.ParentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Couldn't find parent chirp", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get parent chirp", err)
+			return
+		}
+		if parent.Depth >= maxThreadDepth {
+			respondWithError(w, http.StatusBadRequest, "The conversation is too deep to reply to this chirp", nil)
+			return
+		}
+		parentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	if params.PublishAt != nil {
+		apiCfg.scheduleChirp(w, r, user, plan, cleaned, mediaURL, *params.PublishAt)
+		return
+	}
+
 	// If the Chirp is valid, respond with a 200 code and this body:
 	chirp, err := apiCfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleaned,
-		UserID: userID,
+		Body:     cleaned,
+		UserID:   user.ID,
+		MediaUrl: mediaURL,
+		ParentID: parentID,
 	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The parent was deleted since it was read
+		respondWithError(w, http.StatusNotFound, "Couldn't find parent chirp", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, 400, fmt.Sprintf("Couldn't create feed : %s", err), err)
 		return
@@ -81,8 +135,9 @@ func (apiCfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Reque
 	respondWithJSON(w, http.StatusCreated, databaseChirpToChirp(chirp))
 }
 
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
+// validateChirp checks the length of the chirp (maxChirpLength is set by the author's plan)
+// and returns it cleaned of profane words.
+func validateChirp(body string, maxChirpLength int) (string, error) {
 	if len(body) > maxChirpLength {
 		// if the Chirp is too long, respond with a 400 code and this body:
 		// respondWithError(w, http.StatusBadRequest, "Chirp is too long", nil)
@@ -100,6 +155,18 @@ func validateChirp(body string) (string, error) {
 	return cleaned, nil
 }
 
+// validateMediaURL checks that the media of a chirp is an http(s) URL.
+func validateMediaURL(s string) error {
+	if len(s) > maxMediaURLLength {
+		return errors.New("Media URL is too long")
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Media URL must be an http or https URL")
+	}
+	return nil
+}
+
 func getCleanedBody(body string, badWords map[string]struct{}) string {
 	words := strings.Split(body, " ")
 	for i, word := range words {
@@ -117,64 +184,85 @@ func getCleanedBody(body string, badWords map[string]struct{}) string {
 // 5. Storage 11. Get All Chirps
 // Add a GET /api/chirps endpoint that returns all chirps in the database.
 // Order them by created_at in ascending order.
+// The chirps are returned by pages: ?limit= sets the size of the page
+// and ?cursor= takes the next or prev cursor of the previous response.
 func (apiCfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := database.ListChirpsParams{}
+
 	// 9. Documentation 4. Sorting Chirps
 	//  It should accept an optional query parameter called sort
-	sort := r.URL.Query().Get("sort")
-	if sort != "desc" {
-		// asc is the default if no sort query parameter is provided.
-		sort = "asc"
+	// asc is the default if no sort query parameter is provided.
+	sort := query.Get("sort")
+	if sort != "" && sort != "asc" && sort != "desc" {
+		respondWithError(w, http.StatusBadRequest, "Invalid sort", nil)
+		return
 	}
+	params.Descending = sort == "desc"
+
 	// 9. Documentation 1. Documentation
 	// Update the GET /api/chirps endpoint. It should accept an optional query parameter called author_id.
-	authorIDstr := r.URL.Query().Get("author_id")
-	if authorIDstr == "" {
-		// If the author_id query parameter is not provided,
-		// the endpoint should return all chirps as it did before.
-		if sort == "asc" {
-			chirps, err := apiCfg.DB.GetChirpsAsc(r.Context())
-			if err != nil {
-				respondWithError(w, 400, fmt.Sprintf("Couldn't get chirps : %s", err), err)
-				return
-			}
-
-			respondWithJSON(w, http.StatusOK, databaseChirpsToChirps(chirps))
-			return
-		}
-
-		chirps, err := apiCfg.DB.GetChirpsDesc(r.Context())
-		if err != nil {
-			respondWithError(w, 400, fmt.Sprintf("Couldn't get chirps : %s", err), err)
-			return
-		}
-
-		respondWithJSON(w, http.StatusOK, databaseChirpsToChirps(chirps))
-		return
-	}
 	// If the author_id query parameter is provided,
 	// the endpoint should return only the chirps for that author.
-	authorID, err := uuid.Parse(authorIDstr)
+	// The chirps can be filtered by several authors, creation time, text
+	// and Chirpy Red authors too (see chirpfilter.Parse).
+	filter, err := chirpfilter.Parse(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.AuthorIds = filter.AuthorIDs
+	params.CreatedAfter = timeToNullTime(filter.CreatedAfter)
+	params.CreatedBefore = timeToNullTime(filter.CreatedBefore)
+	params.BodyPattern = sql.NullString{String: filter.ContainsPattern(), Valid: filter.Contains != ""}
+	params.RedAuthorsOnly = filter.RedAuthorsOnly
+	if filter.IsReply != nil {
+		params.IsReply = sql.NullBool{Bool: *filter.IsReply, Valid: true}
+	}
+	if filter.HasMedia != nil {
+		params.HasMedia = sql.NullBool{Bool: *filter.HasMedia, Valid: true}
+	}
+
+	limit, err := pagination.ParseLimit(query.Get("limit"))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid author ID", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
 		return
 	}
+	// One more chirp tells if there is a next page
+	params.Limit = int32(limit + 1)
 
-	if sort == "asc" {
-		chirpsByAuthor, err := apiCfg.DB.GetChirpsByAuthorAsc(r.Context(), authorID)
+	var cursor *pagination.Cursor
+	if s := query.Get("cursor"); s != "" {
+		c, err := pagination.DecodeCursor(s)
 		if err != nil {
-			respondWithError(w, 400, fmt.Sprintf("Couldn't get feeds : %s", err), err)
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return
+		}
+		cursor = &c
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+		// The previous page is read in reverse from the cursor
+		if c.Backward {
+			params.Descending = !params.Descending
 		}
-
-		respondWithJSON(w, http.StatusOK, databaseChirpsToChirps(chirpsByAuthor))
-		return
 	}
 
-	chirpsByAuthor, err := apiCfg.DB.GetChirpsByAuthorDesc(r.Context(), authorID)
+	dbChirps, err := apiCfg.DB.ListChirps(r.Context(), params)
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't get feeds : %s", err), err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirps", err)
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, databaseChirpsToChirps(chirpsByAuthor))
+	page := pagination.NewPage(dbChirps, limit, cursor, func(c database.ListChirpsRow) (time.Time, uuid.UUID) {
+		return c.CreatedAt, c.ID
+	})
+	next, prev := encodeCursor(page.Next), encodeCursor(page.Prev)
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps: databaseChirpsToChirps(page.Items),
+		Next:   next,
+		Prev:   prev,
+	})
 }
 
 func (apiCfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
@@ -203,20 +291,8 @@ func (apiCfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request)
 // that deletes a chirp from the database by its id.
 func (apiCfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
 	// To delete a chirp, a user needs to have valid JWT
-	// This is an authenticated endpoint,
-	// so be sure to check the token in the header.
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	// Use your ValidateJWT
-	userID, err := auth.ValidateJWT(token, apiCfg.jwtSecret)
-	if err != nil {
-		// If the JWT is invalid, return a 401 Unauthorized response
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	// This is an authenticated endpoint (checked by middlewareAuth)
+	user, _ := userFromContext(r.Context())
 
 	// You can get the string value of the path parameter like in Go
 	// with the http.Request.PathValue method.
@@ -237,7 +313,8 @@ func (apiCfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Reque
 
 	// Only allow the deletion of a chirp
 	// if the user is the author of the chirp.
-	if userID != dbChirp.UserID {
+	// Its replies stay in the conversation without a parent.
+	if user.ID != dbChirp.UserID {
 		// If they are not, return a 403 status code.
 		respondWithError(w, http.StatusForbidden, "Not an author of the chirp", nil)
 		return
@@ -250,3 +327,99 @@ func (apiCfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Reque
 	// If the chirp is deleted successfully, return a 204 status code.
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// PATCH /api/chirps/{chirpID} replaces the body of a chirp,
+// the previous body is kept as a revision.
+// Only its author may edit it, if their plan allows editing,
+// during the edit window after it was posted.
+func (apiCfg *apiConfig) handlerEditChirp(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	dbChirp, err := apiCfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp", err)
+		return
+	}
+	if user.ID != dbChirp.UserID {
+		respondWithError(w, http.StatusForbidden, "Not an author of the chirp", nil)
+		return
+	}
+
+	plan := apiCfg.planFor(user)
+	if !plan.CanEditChirps {
+		respondWithError(w, http.StatusForbidden, "Editing chirps requires Chirpy Red", nil)
+		return
+	}
+	if time.Since(dbChirp.CreatedAt) > apiCfg.chirpEditWindow {
+		respondWithError(w, http.StatusForbidden, "The chirp can't be edited anymore", nil)
+		return
+	}
+
+	cleaned, err := validateChirp(params.Body, plan.MaxChirpLength)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	// Nothing to keep in a revision
+	if cleaned == dbChirp.Body {
+		respondWithJSON(w, http.StatusOK, databaseChirpToChirp(dbChirp))
+		return
+	}
+
+	dbChirp, err = apiCfg.DB.EditChirp(r.Context(), database.EditChirpParams{
+		ID:   dbChirp.ID,
+		Body: cleaned,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseChirpToChirp(dbChirp))
+}
+
+// GET /api/chirps/{chirpID}/revisions lists the previous bodies of a chirp,
+// newest first.
+func (apiCfg *apiConfig) handlerGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	_, err = apiCfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp", err)
+		return
+	}
+
+	dbRevisions, err := apiCfg.DB.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get revisions", err)
+		return
+	}
+
+	revisions := []ChirpRevision{}
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, databaseChirpRevisionToChirpRevision(dbRevision))
+	}
+	respondWithJSON(w, http.StatusOK, revisions)
+}
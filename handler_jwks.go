@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+// GET /.well-known/jwks.json returns the public keys
+// that verify Chirpy access tokens,
+// so downstream services can check them offline.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	// Retiring keys stay in the set until their tokens expire,
+	// so clients can cache it for a while.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
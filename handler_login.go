@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/Bayan2019/go-http-server/internal/auth"
 	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -18,14 +21,6 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		// in the request body
 		ExpiresInSeconds int `json:"expires_in_seconds"`
 	}
-	// Update the POST /api/login endpoint
-	// to return a refresh token, as well as an access token:
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
@@ -34,17 +29,39 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
+	// Refuse to check passwords while the account or the client is locked
+	// after too many failed attempts.
+	// The attempt is counted before the password is checked.
+	accountKey := accountThrottleKey(params.Email)
+	ipKey := ipThrottleKey(clientIP(r))
+	throttles := loginThrottles(accountKey, ipKey)
+	lockedUntil, err := cfg.takeLoginAttempt(r.Context(), throttles...)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondWithLockout(w, lockedUntil)
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	user, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
+	if err == nil {
+		err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	}
 	if err != nil {
+		// Unknown emails count as failures too,
+		// so they can't be told apart from wrong passwords.
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
+
+	// The password is known now: upgrade a bcrypt hash (or an argon2id hash
+	// with old parameters) to the current algorithm and parameters.
+	if cfg.passwordParams.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r.Context(), user, params.Password)
+	}
+
 	// If it's specified by the client, use it as the expiration time.
 	// If it's not specified, use a default expiration time of 1 hour.
 	// If the client specified a number over 1 hour,
@@ -54,11 +71,42 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		expirationTime = time.Duration(params.ExpiresInSeconds) * time.Second
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		expirationTime,
-	)
+	// Users with 2FA get an MFA challenge token instead,
+	// to exchange with a code at POST /api/login/mfa.
+	// The failed attempts are only reset once the code is checked too.
+	if user.TotpEnabledAt.Valid {
+		// The right password doesn't count as a failure
+		err = cfg.forgiveLoginAttempt(r.Context(), throttles...)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't reset login attempts", err)
+			return
+		}
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	// A successful login resets the account's failed attempts
+	err = cfg.resetLoginAttempts(r.Context(), accountKey, ipKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset login attempts", err)
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user, expirationTime)
+}
+
+// Update the POST /api/login endpoint
+// to return a refresh token, as well as an access token:
+type loginResponse struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// respondWithLogin creates the access token and a new session (refresh token)
+// of a user who logged in.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User, expirationTime time.Duration) {
+	accessToken, err := cfg.jwtKeys.MakeJWT(user.ID, user.Roles, user.TokenVersion, expirationTime)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
 		return
@@ -70,9 +118,16 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dbRefreshToken, err := cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID,
+	// Only the hash of the refresh token is stored,
+	// the plaintext token is returned to the client once.
+	_, err = cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash:   auth.HashRefreshToken(refreshToken, cfg.refreshTokenKey),
+		TokenPrefix: auth.RefreshTokenPrefix(refreshToken),
+		UserID:      user.ID,
+		// Login starts a new token family
+		FamilyID:  uuid.New(),
+		UserAgent: r.UserAgent(),
+		Ip:        clientIP(r),
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError,
@@ -83,15 +138,26 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	// Once you have the token, respond to the request with a 200 code
 	// and this body shape:
 	//
-	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+	respondWithJSON(w, http.StatusOK, loginResponse{
+		User:         databaseUserToUser(user),
 		Token:        accessToken,
-		RefreshToken: dbRefreshToken.Token,
+		RefreshToken: refreshToken,
 	})
 }
+
+// rehashPassword stores a new hash of the user's password.
+// Failing to do so doesn't fail the login, the old hash still works.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	hashedPassword, err := cfg.passwordParams.HashPassword(password)
+	if err != nil {
+		log.Printf("Couldn't rehash password: %s", err)
+		return
+	}
+	_, err = cfg.DB.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		log.Printf("Couldn't store rehashed password: %s", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/mailer"
+)
+
+// Sign-in links are rate limited per email with the login throttles:
+// every request counts, a few per hour are allowed.
+var magicLinkPolicy = auth.LockoutPolicy{
+	Threshold: 3,
+	BaseDelay: 15 * time.Minute,
+	MaxDelay:  time.Hour,
+}
+
+func magicLinkThrottleKey(email string) string {
+	return "magic-link:" + strings.ToLower(email)
+}
+
+// POST /api/login/magic emails a single-use sign-in link, valid 15 minutes.
+// Like POST /api/password-reset, it responds the same way
+// whether the email is known or not.
+func (cfg *apiConfig) handlerRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	// The limit is on the email, not the user,
+	// so being limited doesn't tell whether the email has an account.
+	lockedUntil, err := cfg.takeLoginAttempt(r.Context(), loginThrottle{
+		Key:    magicLinkThrottleKey(params.Email),
+		Policy: magicLinkPolicy,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check sign-in link requests", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondWithLockout(w, lockedUntil)
+		return
+	}
+
+	user, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create sign-in token", err)
+		return
+	}
+	_, err = cfg.DB.CreateMagicLinkToken(r.Context(), database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save sign-in token", err)
+		return
+	}
+
+	err = cfg.mailer.Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Sign in to Chirpy",
+		Body: fmt.Sprintf(
+			"Someone asked to sign in to your Chirpy account without a password.\n\n"+
+				"Open this link to sign in:\n\n%s/api/login/magic/redeem?token=%s\n\n"+
+				"It can be used once and expires in 15 minutes. If it wasn't you, ignore this email.",
+			cfg.baseURL, url.QueryEscape(token),
+		),
+	})
+	if err != nil {
+		// Don't tell the client, the response must not depend on the email
+		log.Printf("Couldn't send sign-in email: %s", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GET /api/login/magic/redeem?token=... (the emailed link)
+// and POST /api/login/magic/redeem (a client forwarding the token)
+// log the user in with the token of a sign-in link.
+// They respond like POST /api/login.
+func (cfg *apiConfig) handlerRedeemMagicLink(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token            string `json:"token"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+
+	params := parameters{}
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		params.Token = query.Get("token")
+		if s := query.Get("expires_in_seconds"); s != "" {
+			seconds, err := strconv.Atoi(s)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid expires_in_seconds", err)
+				return
+			}
+			params.ExpiresInSeconds = seconds
+		}
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+	if params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing token", nil)
+		return
+	}
+
+	magicLinkToken, err := cfg.DB.UseMagicLinkToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "Sign-in token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't use sign-in token", err)
+		return
+	}
+
+	user, err := cfg.DB.GetUserByID(r.Context(), magicLinkToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	// The link replaces the password, not the second factor
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	expirationTime := time.Hour
+	if params.ExpiresInSeconds > 0 && params.ExpiresInSeconds < 3600 {
+		expirationTime = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	cfg.respondWithLogin(w, r, user, expirationTime)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+)
+
+const (
+	// How long the password check of a 2FA login stays valid
+	mfaTokenLifetime = 5 * time.Minute
+	// Number of recovery codes given when 2FA is enabled
+	recoveryCodesCount = 10
+	// Issuer shown in authenticator apps
+	totpIssuer = "Chirpy"
+)
+
+// Returned by POST /api/login for users with 2FA
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// respondWithMFAChallenge responds to the first step of the login of a user with 2FA
+// with a token to exchange with a code at POST /api/login/mfa.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	mfaToken, err := cfg.jwtKeys.MakeMFAToken(user.ID, mfaTokenLifetime)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create MFA token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, mfaChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// POST /api/2fa/enroll generates a new TOTP secret for the authenticated user.
+// 2FA is enabled once the secret is confirmed with POST /api/2fa/confirm.
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	// A stolen access token must not be enough to replace the secret
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "2FA is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate TOTP secret", err)
+		return
+	}
+	_, err = cfg.DB.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save TOTP secret", err)
+		return
+	}
+
+	type response struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Secret: secret,
+		URI:    auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// POST /api/2fa/confirm enables 2FA with a code of the enrolled secret
+// and returns the one-time recovery codes (only this once).
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "2FA enrollment wasn't started", nil)
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid 2FA code", nil)
+		return
+	}
+
+	_, err = cfg.DB.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable 2FA", err)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate recovery codes", err)
+		return
+	}
+	err = cfg.DB.DeleteRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete recovery codes", err)
+		return
+	}
+	for _, code := range codes {
+		err = cfg.DB.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashToken(code),
+			UserID:   user.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save recovery codes", err)
+			return
+		}
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// POST /api/login/mfa exchanges the MFA challenge token of POST /api/login
+// and a TOTP (or recovery) code for the access and refresh tokens.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken         string `json:"mfa_token"`
+		Code             string `json:"code"`
+		RecoveryCode     string `json:"recovery_code"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	userID, err := cfg.jwtKeys.ValidateMFAToken(params.MFAToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid MFA token", err)
+		return
+	}
+	user, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for MFA token", err)
+		return
+	}
+
+	// Codes are throttled like passwords
+	accountKey := accountThrottleKey(user.Email)
+	ipKey := ipThrottleKey(clientIP(r))
+	lockedUntil, err := cfg.takeLoginAttempt(r.Context(), loginThrottles(accountKey, ipKey)...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondWithLockout(w, lockedUntil)
+		return
+	}
+
+	err = cfg.checkSecondFactor(r, user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid 2FA code", err)
+		return
+	}
+
+	err = cfg.resetLoginAttempts(r.Context(), accountKey, ipKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset login attempts", err)
+		return
+	}
+
+	expirationTime := time.Hour
+	if params.ExpiresInSeconds > 0 && params.ExpiresInSeconds < 3600 {
+		expirationTime = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	cfg.respondWithLogin(w, r, user, expirationTime)
+}
+
+// checkSecondFactor checks a TOTP code, or else a one-time recovery code.
+// Both can be used only once.
+func (cfg *apiConfig) checkSecondFactor(r *http.Request, user database.User, code, recoveryCode string) error {
+	if !user.TotpEnabledAt.Valid || !user.TotpSecret.Valid {
+		return errors.New("2FA is not enabled")
+	}
+
+	if recoveryCode != "" {
+		_, err := cfg.DB.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+			UserID:   user.ID,
+		})
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return errors.New("invalid TOTP code")
+	}
+	// The same code can't be replayed
+	_, err := cfg.DB.UseUserTOTPStep(r.Context(), database.UseUserTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	return err
+}
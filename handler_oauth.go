@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Chirpy is an OAuth 2.0 authorization server (RFC 6749)
+// for third-party clients, so they never see the users' passwords.
+// Only the authorization code grant with PKCE (RFC 7636) is supported.
+// Clients get access tokens limited to the scopes the user consented to
+// and refresh tokens to renew them.
+
+// How long the access tokens of OAuth clients are valid
+const oauthAccessTokenLifetime = time.Hour
+
+// Shown on the consent page for each scope
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:  "Read chirps",
+	auth.ScopeChirpsWrite: "Post and delete chirps as you",
+}
+
+// Parameters of an authorization request,
+// sent as query parameters to GET /oauth/authorize
+// and carried by the consent form to POST /oauth/authorize.
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func newAuthorizeRequest(values url.Values) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// The consent page is built into the binary,
+// so it's never among the files served at /app/
+//
+//go:embed templates/consent.html
+var consentPageTemplate string
+
+// Data of the consent page (templates/consent.html)
+type consentPage struct {
+	ClientName string
+	Scopes     []string
+	Request    authorizeRequest
+	Error      string
+}
+
+// OAuth errors are reported with the error codes of RFC 6749
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// GET /oauth/authorize shows the consent page of an authorization request.
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	req := newAuthorizeRequest(r.URL.Query())
+
+	client, err := cfg.getOAuthClientForRedirect(r.Context(), req)
+	if err != nil {
+		// Never redirect to an unregistered URI
+		cfg.renderConsentPage(w, http.StatusBadRequest, consentPage{Error: err.Error()})
+		return
+	}
+	scopes, oerr := req.validate()
+	if oerr != nil {
+		redirectWithOAuthError(w, r, req, *oerr)
+		return
+	}
+
+	cfg.renderConsentPage(w, http.StatusOK, newConsentPage(client, scopes, req, ""))
+}
+
+// POST /oauth/authorize handles the consent form:
+// the user logs in and allows (or denies) the client,
+// then is redirected back to the client with an authorization code.
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusBadRequest, consentPage{Error: "Couldn't parse the form"})
+		return
+	}
+	req := newAuthorizeRequest(r.PostForm)
+
+	client, err := cfg.getOAuthClientForRedirect(r.Context(), req)
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusBadRequest, consentPage{Error: err.Error()})
+		return
+	}
+	scopes, oerr := req.validate()
+	if oerr != nil {
+		redirectWithOAuthError(w, r, req, *oerr)
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		redirectWithOAuthError(w, r, req, oauthError{Code: "access_denied", Description: "The user denied the request"})
+		return
+	}
+
+	// The user logs in like at POST /api/login (and POST /api/login/mfa),
+	// with the same throttling of failed attempts.
+	email := r.PostForm.Get("email")
+	accountKey := accountThrottleKey(email)
+	ipKey := ipThrottleKey(clientIP(r))
+	lockedUntil, err := cfg.takeLoginAttempt(r.Context(), loginThrottles(accountKey, ipKey)...)
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusInternalServerError, newConsentPage(client, scopes, req, "Couldn't check login attempts"))
+		return
+	}
+	if !lockedUntil.IsZero() {
+		cfg.renderConsentPage(w, http.StatusTooManyRequests, newConsentPage(client, scopes, req, "Too many failed login attempts, try again later"))
+		return
+	}
+
+	user, err := cfg.DB.GetUserByEmail(r.Context(), email)
+	if err == nil {
+		err = auth.CheckPasswordHash(r.PostForm.Get("password"), user.HashedPassword)
+	}
+	if err == nil && user.TotpEnabledAt.Valid {
+		err = cfg.checkSecondFactor(r, user, r.PostForm.Get("code"), "")
+	}
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusUnauthorized, newConsentPage(client, scopes, req, "Incorrect email, password or 2FA code"))
+		return
+	}
+
+	err = cfg.resetLoginAttempts(r.Context(), accountKey, ipKey)
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusInternalServerError, newConsentPage(client, scopes, req, "Couldn't reset login attempts"))
+		return
+	}
+
+	// The code is single-use and short-lived (see oauth_authorization_codes.sql),
+	// only its hash is stored.
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusInternalServerError, newConsentPage(client, scopes, req, "Couldn't create authorization code"))
+		return
+	}
+	_, err = cfg.DB.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+	})
+	if err != nil {
+		cfg.renderConsentPage(w, http.StatusInternalServerError, newConsentPage(client, scopes, req, "Couldn't save authorization code"))
+		return
+	}
+
+	redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// POST /oauth/token exchanges an authorization code (or a refresh token)
+// for an access token limited to the granted scopes.
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "Couldn't parse the form"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		log.Println(err)
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthError{Code: "invalid_client"})
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := cfg.DB.UseOAuthAuthorizationCode(r.Context(), database.UseOAuthAuthorizationCodeParams{
+			CodeHash: auth.HashToken(r.PostForm.Get("code")),
+			ClientID: client.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: "The code is invalid, expired or already used"})
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get authorization code", err)
+			return
+		}
+		if code.RedirectUri != r.PostForm.Get("redirect_uri") {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: "redirect_uri doesn't match"})
+			return
+		}
+		if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: "code_verifier doesn't match"})
+			return
+		}
+		cfg.respondWithOAuthTokens(w, r, client.ID, code.UserID, code.Scopes)
+
+	case "refresh_token":
+		// Refresh tokens are rotated: each one can be used only once
+		token, err := cfg.DB.RotateOAuthRefreshToken(r.Context(), database.RotateOAuthRefreshTokenParams{
+			TokenHash: auth.HashToken(r.PostForm.Get("refresh_token")),
+			ClientID:  client.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: "The refresh token is invalid, expired or revoked"})
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+			return
+		}
+		cfg.respondWithOAuthTokens(w, r, client.ID, token.UserID, token.Scopes)
+
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "unsupported_grant_type"})
+	}
+}
+
+// POST /oauth/revoke revokes a refresh token of the client (RFC 7009).
+// Access tokens can't be revoked, they expire within the hour.
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "Couldn't parse the form"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		log.Println(err)
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthError{Code: "invalid_client"})
+		return
+	}
+
+	err = cfg.DB.RevokeOAuthRefreshToken(r.Context(), database.RevokeOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(r.PostForm.Get("token")),
+		ClientID:  client.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+
+	// Unknown tokens are not an error, the client can't do anything about them
+	w.WriteHeader(http.StatusOK)
+}
+
+// respondWithOAuthTokens issues a scoped access token
+// and a new refresh token to the client.
+func (cfg *apiConfig) respondWithOAuthTokens(w http.ResponseWriter, r *http.Request, clientID, userID uuid.UUID, scopes []string) {
+	user, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	// The token version ties the access token to the user's password and sessions
+	accessToken, err := cfg.jwtKeys.MakeScopedJWT(user.ID, scopes, user.TokenVersion, oauthAccessTokenLifetime)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+		return
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+	_, err = cfg.DB.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
+		return
+	}
+
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenLifetime.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// getOAuthClientForRedirect returns the client of an authorization request
+// if its redirect_uri is one of the client's registered URIs.
+// Until this is checked, errors can't be sent back to the client.
+func (cfg *apiConfig) getOAuthClientForRedirect(ctx context.Context, req authorizeRequest) (database.OauthClient, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	client, err := cfg.DB.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	if err != nil {
+		log.Println(err)
+		return database.OauthClient{}, errors.New("couldn't get client")
+	}
+	for _, uri := range client.RedirectUris {
+		if uri == req.RedirectURI {
+			return client, nil
+		}
+	}
+	return database.OauthClient{}, errors.New("redirect_uri is not registered for the client")
+}
+
+// validate checks the parameters of an authorization request
+// other than the client and returns the requested scopes.
+func (req authorizeRequest) validate() ([]string, *oauthError) {
+	if req.ResponseType != "code" {
+		return nil, &oauthError{Code: "unsupported_response_type", Description: "Only the code response type is supported"}
+	}
+	if req.CodeChallengeMethod != auth.PKCEMethodS256 || !auth.ValidPKCEChallenge(req.CodeChallenge) {
+		return nil, &oauthError{Code: "invalid_request", Description: "PKCE with the S256 method is required"}
+	}
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		return nil, &oauthError{Code: "invalid_scope", Description: "At least one scope is required"}
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return nil, &oauthError{Code: "invalid_scope", Description: "Unknown scope " + scope}
+		}
+	}
+	return scopes, nil
+}
+
+// authenticateOAuthClient authenticates the client of a token request
+// with HTTP basic auth or the client_id and client_secret form parameters.
+// Public clients (without a secret) only send their client_id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	client, err := cfg.DB.GetOAuthClient(r.Context(), id)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash.Valid &&
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("invalid client secret")
+	}
+	return client, nil
+}
+
+func newConsentPage(client database.OauthClient, scopes []string, req authorizeRequest, errMsg string) consentPage {
+	page := consentPage{
+		ClientName: client.Name,
+		Request:    req,
+		Error:      errMsg,
+	}
+	for _, scope := range scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	return page
+}
+
+func (cfg *apiConfig) renderConsentPage(w http.ResponseWriter, code int, page consentPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The page takes the user's password: it must not be framed
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(code)
+	err := cfg.consentTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+// redirectToClient redirects the user back to the client's redirect_uri
+// with the parameters and the state of the request.
+func redirectToClient(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	redirectURI, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid redirect_uri", err)
+		return
+	}
+	query := redirectURI.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func redirectWithOAuthError(w http.ResponseWriter, r *http.Request, req authorizeRequest, oerr oauthError) {
+	redirectToClient(w, r, req, url.Values{
+		"error":             {oerr.Code},
+		"error_description": {oerr.Description},
+	})
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oerr oauthError) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, oerr)
+}
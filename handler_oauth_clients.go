@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Developers of third-party apps register them as OAuth clients
+// with a login session (see middlewareAuth).
+
+// POST /api/oauth/clients registers an OAuth client.
+// The secret of a confidential client is returned only this once.
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		// Confidential clients (e.g. web servers) can keep a secret,
+		// public ones (mobile and browser apps) can't
+		Confidential bool `json:"confidential"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Client name is required", nil)
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one redirect URI is required", nil)
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		err := validateRedirectURI(redirectURI)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid redirect URI "+redirectURI, err)
+			return
+		}
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create client secret", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.DB.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       user.ID,
+		Name:         params.Name,
+		RedirectUris: params.RedirectURIs,
+		SecretHash:   secretHash,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create client", err)
+		return
+	}
+
+	type response struct {
+		OAuthClient
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+	respondWithJSON(w, http.StatusCreated, response{
+		OAuthClient:  databaseOAuthClientToOAuthClient(client),
+		ClientSecret: secret,
+	})
+}
+
+// GET /api/oauth/clients lists the OAuth clients registered by the user.
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	dbClients, err := cfg.DB.GetOAuthClientsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get clients", err)
+		return
+	}
+
+	clients := []OAuthClient{}
+	for _, dbClient := range dbClients {
+		clients = append(clients, databaseOAuthClientToOAuthClient(dbClient))
+	}
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// DELETE /api/oauth/clients/{clientID} deletes an OAuth client
+// with its codes and refresh tokens.
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	deleted, err := cfg.DB.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find client", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateRedirectURI checks that the codes are only sent over https,
+// or over http to the user's own machine (loopback, RFC 8252).
+// Other schemes (javascript:, data:...) are refused.
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" || u.Fragment != "" {
+		return errors.New("redirect URI must be an absolute URL without fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+		return errors.New("http redirect URIs must be on a loopback host")
+	default:
+		return errors.New("redirect URI must use https")
+	}
+}
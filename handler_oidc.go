@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/oidc"
+)
+
+// Users can log in with an external OpenID Connect provider
+// (e.g. a corporate identity provider) set with OIDC_ISSUER.
+// The identity is linked to the Chirpy user with its verified email,
+// a user is created for new emails.
+
+// Returned when the provider's identity can't be linked to a user
+var errIdentityNotLinkable = errors.New("identity can't be linked")
+
+// GET /api/login/oidc redirects the user to the provider.
+func (cfg *apiConfig) handlerLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	state, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create state", err)
+		return
+	}
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create nonce", err)
+		return
+	}
+	codeVerifier, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create code verifier", err)
+		return
+	}
+
+	// Kept until the callback (for 10 minutes at most)
+	_, err = cfg.DB.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save login state", err)
+		return
+	}
+
+	http.Redirect(w, r, cfg.oidcProvider.AuthCodeURL(state, nonce, auth.PKCEChallenge(codeVerifier)), http.StatusFound)
+}
+
+// GET /api/login/oidc/callback is where the provider sends the user back.
+// It logs the user in like POST /api/login.
+func (cfg *apiConfig) handlerLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		respondWithError(w, http.StatusUnauthorized, "Identity provider error: "+query.Get("error"), nil)
+		return
+	}
+
+	// The state is single-use and ties the callback
+	// to the login started by this server
+	loginState, err := cfg.DB.UseOIDCLoginState(r.Context(), auth.HashToken(query.Get("state")))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired login state", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get login state", err)
+		return
+	}
+
+	rawIDToken, err := cfg.oidcProvider.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't exchange authorization code", err)
+		return
+	}
+	idToken, err := cfg.oidcProvider.VerifyIDToken(r.Context(), rawIDToken, loginState.Nonce)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid ID token", err)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), idToken)
+	if errors.Is(err, errIdentityNotLinkable) {
+		respondWithError(w, http.StatusConflict, "Couldn't link the identity to a user", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	// Users with 2FA still need their code
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user, time.Hour)
+}
+
+// GET /api/identities lists the external identities linked to the user.
+func (cfg *apiConfig) handlerGetIdentities(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	dbIdentities, err := cfg.DB.GetUserIdentities(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get identities", err)
+		return
+	}
+
+	identities := []Identity{}
+	for _, dbIdentity := range dbIdentities {
+		identities = append(identities, databaseIdentityToIdentity(dbIdentity))
+	}
+	respondWithJSON(w, http.StatusOK, identities)
+}
+
+// userForIdentity returns the user linked to the identity of the ID token.
+// An identity seen for the first time is linked to the user with its email,
+// or to a new user.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, idToken *oidc.IDToken) (database.User, error) {
+	userID, err := cfg.DB.UseUserIdentity(ctx, database.UseUserIdentityParams{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+		Email:   idToken.Email,
+	})
+	if err == nil {
+		return cfg.DB.GetUserByID(ctx, userID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	// Only emails the provider verified are linked
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return database.User{}, errIdentityNotLinkable
+	}
+
+	user, err := cfg.DB.GetUserByEmail(ctx, idToken.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = cfg.createUserForIdentity(ctx, idToken.Email)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	// Someone could have signed up with the email without owning it:
+	// linking their account would let them in as the identity's owner.
+	if !user.EmailVerifiedAt.Valid {
+		return database.User{}, errIdentityNotLinkable
+	}
+
+	_, err = cfg.DB.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+		Email:   idToken.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// createUserForIdentity creates the user of a new identity.
+// Its email is verified by the provider,
+// its random password is never given out (it can be reset by email).
+func (cfg *apiConfig) createUserForIdentity(ctx context.Context, email string) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := cfg.passwordParams.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := cfg.DB.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return cfg.DB.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		ID:    user.ID,
+		Email: email,
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/mailer"
+)
+
+// POST /api/password-reset emails a single-use password reset token.
+// It responds the same way whether the email is known or not,
+// so it can't be used to find out who has an account.
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token", err)
+		return
+	}
+	_, err = cfg.DB.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save reset token", err)
+		return
+	}
+
+	err = cfg.mailer.Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your Chirpy account.\n\n"+
+				"To choose a new password, send this token to %s/api/password-reset/confirm:\n\n%s\n\n"+
+				"It expires in 1 hour. If it wasn't you, ignore this email.",
+			cfg.baseURL, token,
+		),
+	})
+	if err != nil {
+		// Don't tell the client, the response must not depend on the email
+		log.Printf("Couldn't send password reset email: %s", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// POST /api/password-reset/confirm sets a new password with a reset token.
+// The token can be used once, and all sessions of the user are logged out.
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	// The token is only used once the new password is accepted,
+	// so a password rejected by the policy can be retried with it
+	resetToken, err := cfg.DB.GetPasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Reset token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get reset token", err)
+		return
+	}
+
+	user, err := cfg.DB.GetUserByID(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if !cfg.checkPasswordPolicy(w, params.Password, user.Email) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwordParams.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	// Only one request can use the token
+	resetToken, err = cfg.DB.UsePasswordResetToken(r.Context(), resetToken.TokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Reset token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't use reset token", err)
+		return
+	}
+	_, err = cfg.DB.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             resetToken.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+		return
+	}
+
+	// Other outstanding reset tokens, all sessions and access tokens
+	// die with the old password
+	err = cfg.DB.DeletePasswordResetTokens(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete reset tokens", err)
+		return
+	}
+	err = cfg.DB.RevokeAllSessions(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	_, err = cfg.DB.BumpUserTokenVersion(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
 )
 
+// errRefreshTokenReused is returned when the presented refresh token
+// was already rotated or revoked.
+var errRefreshTokenReused = errors.New("refresh token was already used")
+
 // 6. Authentication / 11. Refresh Tokens
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	// This new endpoint does not accept a request body,
@@ -19,7 +26,19 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.DB.GetUserFromRefreshToken(r.Context(), refreshToken)
+	// Refresh tokens are looked up by their hash
+	refreshTokenHash := auth.HashRefreshToken(refreshToken, cfg.refreshTokenKey)
+	dbRefreshToken, err := cfg.DB.GetRefreshToken(r.Context(), refreshTokenHash)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		return
+	}
+	if dbRefreshToken.ExpiresAt.Before(time.Now()) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is expired", nil)
+		return
+	}
+
+	user, err := cfg.DB.GetUserByID(r.Context(), dbRefreshToken.UserID)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
@@ -27,19 +46,64 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 
 	// respond with a 200 code and this shape:
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	// The token field should be a newly created access token for the given user that expires in 1 hour.
 	expirationTime := time.Hour
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		expirationTime,
-	)
+	accessToken, err := cfg.jwtKeys.MakeJWT(user.ID, user.Roles, user.TokenVersion, expirationTime)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response{Token: accessToken})
+	// The new refresh token stays in the family of the old one
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+
+	// Every refresh token can be used only once.
+	// It's revoked in the transaction that saves the new one,
+	// so if saving it fails the old token still works.
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		_, err := q.RotateRefreshToken(r.Context(), refreshTokenHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errRefreshTokenReused
+		}
+		if err != nil {
+			return err
+		}
+		_, err = q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+			TokenHash:   auth.HashRefreshToken(newRefreshToken, cfg.refreshTokenKey),
+			TokenPrefix: auth.RefreshTokenPrefix(newRefreshToken),
+			UserID:      user.ID,
+			FamilyID:    dbRefreshToken.FamilyID,
+			UserAgent:   r.UserAgent(),
+			Ip:          clientIP(r),
+		})
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		// The token was already rotated (or revoked):
+		// someone is replaying an old token,
+		// so revoke the whole token family.
+		err = cfg.DB.RevokeTokenFamily(r.Context(), dbRefreshToken.FamilyID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token family", err)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
+	})
 }
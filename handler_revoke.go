@@ -22,7 +22,8 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	// by setting the revoked_at to the current timestamp.
 	// Remember that any time you update a record,
 	// you should also be updating the updated_at timestamp.
-	_, err = cfg.DB.RevokeToken(r.Context(), refreshToken)
+	// Refresh tokens are stored (and looked up) by their hash.
+	_, err = cfg.DB.RevokeToken(r.Context(), auth.HashRefreshToken(refreshToken, cfg.refreshTokenKey))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't Revoke Token", err)
 		return
@@ -32,3 +33,22 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	// Respifond with a 204 status code.
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// POST /api/logout revokes the access token of the request
+// until it expires. Its refresh token is revoked with POST /api/revoke.
+func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	claims, _ := claimsFromContext(r.Context())
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		respondWithError(w, http.StatusBadRequest, "The access token can't be revoked", nil)
+		return
+	}
+
+	err := cfg.revokeAccessToken(r.Context(), claims, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+// Chirpy Red members can post chirps later:
+// POST /api/chirps with a publish_at keeps the chirp in scheduled_chirps
+// until a background job posts it.
+
+// How often the due scheduled chirps are posted
+const scheduledChirpsInterval = 30 * time.Second
+
+// How far ahead chirps can be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// scheduleChirp keeps the validated chirp until publishAt.
+func (cfg *apiConfig) scheduleChirp(w http.ResponseWriter, r *http.Request, user database.User, plan entitlements.Plan, body string, mediaURL sql.NullString, publishAt time.Time) {
+	if !plan.CanScheduleChirps {
+		respondWithError(w, http.StatusForbidden, "Scheduling chirps requires Chirpy Red", nil)
+		return
+	}
+	now := time.Now()
+	if !publishAt.After(now) {
+		respondWithError(w, http.StatusBadRequest, "publish_at must be in the future", nil)
+		return
+	}
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		respondWithError(w, http.StatusBadRequest, "publish_at is too far ahead", nil)
+		return
+	}
+
+	scheduledChirp, err := cfg.DB.CreateScheduledChirp(r.Context(), database.CreateScheduledChirpParams{
+		UserID:    user.ID,
+		Body:      body,
+		MediaUrl:  mediaURL,
+		PublishAt: publishAt.UTC(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't schedule chirp", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, databaseScheduledChirpToScheduledChirp(scheduledChirp))
+}
+
+// GET /api/chirps/scheduled lists the user's scheduled chirps.
+func (cfg *apiConfig) handlerGetScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	dbChirps, err := cfg.DB.GetScheduledChirps(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get scheduled chirps", err)
+		return
+	}
+
+	chirps := []ScheduledChirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, databaseScheduledChirpToScheduledChirp(dbChirp))
+	}
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// DELETE /api/chirps/scheduled/{scheduledChirpID} cancels a scheduled chirp.
+func (cfg *apiConfig) handlerDeleteScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	scheduledChirpID, err := uuid.Parse(r.PathValue("scheduledChirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid scheduled chirp ID", err)
+		return
+	}
+
+	deleted, err := cfg.DB.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID:     scheduledChirpID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete scheduled chirp", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find scheduled chirp", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runScheduledChirps posts the scheduled chirps when they are due
+// until the context is done.
+func (cfg *apiConfig) runScheduledChirps(ctx context.Context) {
+	ticker := time.NewTicker(scheduledChirpsInterval)
+	defer ticker.Stop()
+	for {
+		err := cfg.postDueChirps(ctx)
+		if err != nil {
+			log.Printf("Couldn't post scheduled chirps: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) postDueChirps(ctx context.Context) error {
+	_, err := cfg.DB.PublishDueScheduledChirps(ctx)
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/pagination"
+	"github.com/Bayan2019/go-http-server/internal/search"
+)
+
+// GET /api/search/chirps?q= searches the chirps, best matches first
+// (see package search for the syntax of q).
+// ?limit= and ?cursor= page through the results like GET /api/chirps.
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	tsquery, err := search.ParseQuery(query.Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid search: "+err.Error(), err)
+		return
+	}
+
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+		return
+	}
+	offset := 0
+	if s := query.Get("cursor"); s != "" {
+		offset, err = pagination.DecodeOffset(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return
+		}
+	}
+
+	rows, err := cfg.DB.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query: tsquery,
+		// One more result tells if there is a next page
+		Limit:  int32(limit + 1),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps", err)
+		return
+	}
+
+	next, prev := "", ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		if offset+limit <= pagination.MaxOffset {
+			next = pagination.EncodeOffset(offset + limit)
+		}
+	}
+	if offset > 0 {
+		prev = pagination.EncodeOffset(max(offset-limit, 0))
+	}
+	setPageLinks(w, r, next, prev)
+
+	results := []SearchResult{}
+	for _, row := range rows {
+		results = append(results, databaseSearchRowToSearchResult(row))
+	}
+	respondWithJSON(w, http.StatusOK, SearchResultsPage{
+		Results: results,
+		Next:    next,
+		Prev:    prev,
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// GET /api/sessions lists the active sessions (token families)
+// of the authenticated user.
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	dbSessions, err := cfg.DB.GetActiveSessions(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseSessionsToSessions(dbSessions))
+}
+
+// DELETE /api/sessions/{sessionID} revokes a single session
+// of the authenticated user.
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	revoked, err := cfg.DB.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		// Sessions of other users are reported as not found too
+		respondWithError(w, http.StatusNotFound, "Couldn't find session", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/sessions revokes every session of the authenticated user
+// ("log out everywhere").
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	err := cfg.DB.RevokeAllSessions(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	// and every access token still alive
+	_, err = cfg.DB.BumpUserTokenVersion(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/pagination"
+	"github.com/Bayan2019/go-http-server/internal/thread"
+	"github.com/google/uuid"
+)
+
+// Chirps can reply to other chirps (POST /api/chirps with a parent_id),
+// the replies form a conversation under its first chirp.
+
+// How deep conversations may go
+const maxThreadDepth = 64
+
+// Depth of the replies GET /api/chirps/{chirpID}/thread returns by default
+const defaultThreadDepth = 10
+
+// GET /api/chirps/{chirpID}/thread returns the conversation of a chirp:
+// its first chirp and a page of the replies as trees.
+// ?depth= sets how deep the replies go, ?limit= and ?cursor= page through them
+// like GET /api/chirps (oldest first).
+func (apiCfg *apiConfig) handlerGetThread(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+	dbChirp, err := apiCfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp", err)
+		return
+	}
+
+	depth := defaultThreadDepth
+	if s := query.Get("depth"); s != "" {
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 1 || depth > maxThreadDepth {
+			respondWithError(w, http.StatusBadRequest, "Invalid depth", err)
+			return
+		}
+	}
+
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+		return
+	}
+
+	params := database.GetThreadChirpsParams{
+		RootID:   dbChirp.RootID,
+		MaxDepth: int32(depth),
+		// One more chirp tells if there is a next page
+		Limit: int32(limit + 1),
+	}
+	var cursor *pagination.Cursor
+	if s := query.Get("cursor"); s != "" {
+		c, err := pagination.DecodeCursor(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return
+		}
+		cursor = &c
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+		// The previous page is read in reverse from the cursor
+		params.Descending = c.Backward
+	}
+
+	// The first chirp of the conversation may have been deleted
+	var root *Chirp
+	dbRoot, err := apiCfg.DB.GetChirp(r.Context(), dbChirp.RootID)
+	if err == nil {
+		chirp := databaseChirpToChirp(dbRoot)
+		root = &chirp
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp", err)
+		return
+	}
+
+	dbReplies, err := apiCfg.DB.GetThreadChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get replies", err)
+		return
+	}
+
+	page := pagination.NewPage(dbReplies, limit, cursor, func(c database.GetThreadChirpsRow) (time.Time, uuid.UUID) {
+		return c.CreatedAt, c.ID
+	})
+	next, prev := encodeCursor(page.Next), encodeCursor(page.Prev)
+	setPageLinks(w, r, next, prev)
+
+	// Replies to the first chirp (which isn't among them) are the roots of the trees
+	replies := thread.Build(page.Items, func(c database.GetThreadChirpsRow) uuid.UUID {
+		return c.ID
+	}, func(c database.GetThreadChirpsRow) uuid.NullUUID {
+		return c.ParentID
+	})
+
+	respondWithJSON(w, http.StatusOK, ThreadPage{
+		Root:    root,
+		Replies: threadNodesToThreadChirps(replies),
+		Next:    next,
+		Prev:    prev,
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Personal access tokens let scripts and bots use the API
+// without the user's password.
+// They are managed with a login session only (see middlewareAuth).
+
+// POST /api/tokens creates a named, scoped personal access token.
+// The token is returned only this once.
+func (cfg *apiConfig) handlerCreateToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	type parameters struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// Optional, the token never expires without it
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Token name is required", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required", nil)
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !auth.ValidScope(scope) {
+			respondWithError(w, http.StatusBadRequest, "Unknown scope "+scope, nil)
+			return
+		}
+	}
+	if params.ExpiresInDays < 0 {
+		respondWithError(w, http.StatusBadRequest, "expires_in_days must be positive", nil)
+		return
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{
+			Time:  time.Now().UTC().AddDate(0, 0, params.ExpiresInDays),
+			Valid: true,
+		}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+	pat, err := cfg.DB.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:      user.ID,
+		Name:        params.Name,
+		TokenHash:   auth.HashToken(token),
+		TokenPrefix: token[:len(auth.PersonalAccessTokenPrefix)+auth.RefreshTokenPrefixLength],
+		Scopes:      params.Scopes,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save token", err)
+		return
+	}
+
+	type response struct {
+		PersonalAccessToken
+		Token string `json:"token"`
+	}
+	respondWithJSON(w, http.StatusCreated, response{
+		PersonalAccessToken: databasePersonalAccessTokenToPersonalAccessToken(pat),
+		Token:               token,
+	})
+}
+
+// GET /api/tokens lists the personal access tokens of the user
+// (without the tokens themselves).
+func (cfg *apiConfig) handlerGetTokens(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	dbTokens, err := cfg.DB.GetPersonalAccessTokens(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tokens", err)
+		return
+	}
+
+	tokens := []PersonalAccessToken{}
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, databasePersonalAccessTokenToPersonalAccessToken(dbToken))
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// DELETE /api/tokens/{tokenID} revokes a personal access token.
+func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+
+	revoked, err := cfg.DB.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find token", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"github.com/Bayan2019/go-http-server/internal/auth"
@@ -26,9 +28,13 @@ func (apiCfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !apiCfg.checkPasswordPolicy(w, params.Password, params.Email) {
+		return
+	}
+
 	// 6. Authentication / 1. Authentication with Passwords
-	// Hash the password using the bcrypt.GenerateFromPassword function
-	hashedPassword, err := auth.HashPassword(params.Password)
+	// Hash the password with argon2id (see auth.Argon2Params)
+	hashedPassword, err := apiCfg.passwordParams.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
 		return
@@ -40,6 +46,15 @@ func (apiCfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Reques
 	})
 	if err != nil {
 		respondWithError(w, 400, "Couldn't create user", err)
+		return
+	}
+
+	// The email stays unverified until the link sent to it is opened.
+	// The user is created anyway if it isn't sent,
+	// a new one can be sent with POST /api/verify-email/resend.
+	err = apiCfg.sendEmailVerification(r.Context(), user.ID, user.Email)
+	if err != nil {
+		log.Printf("Couldn't send verification email to user %s: %s", user.ID, err)
 	}
 
 	respondWithJSON(w, 201, databaseUserToUser(user))
@@ -50,24 +65,8 @@ func (apiCfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Reques
 // that users can update their own (but not other's) email and password.
 func (apiCfg *apiConfig) handlerEditUser(w http.ResponseWriter, r *http.Request) {
 	// An access token in the header
-	// To change info, a user needs to have valid JWT
-	// Use your GetBearerToken
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		// If the access token is malformed or missing,
-		// respond with a 401 status code.
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	// Use your ValidateJWT
-	userID, err := auth.ValidateJWT(token, apiCfg.jwtSecret)
-	if err != nil {
-		// If the JWT is invalid, return a 401 Unauthorized response
-		// If the access token is malformed or missing,
-		// respond with a 401 status code.
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	// (validated by middlewareAuth)
+	authUser, _ := userFromContext(r.Context())
 
 	// A new password and email in the request body
 	type parameters struct {
@@ -77,28 +76,61 @@ func (apiCfg *apiConfig) handlerEditUser(w http.ResponseWriter, r *http.Request)
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 
-	// Hash the password using the bcrypt.GenerateFromPassword function
-	hashedPassword, err := auth.HashPassword(params.Password)
+	email := authUser.Email
+	if params.Email != "" {
+		email = params.Email
+	}
+	if !apiCfg.checkPasswordPolicy(w, params.Password, email) {
+		return
+	}
+
+	// Hash the password with argon2id (see auth.Argon2Params)
+	hashedPassword, err := apiCfg.passwordParams.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
 		return
 	}
 
-	// update the hashed password and the email
+	// update the hashed password
 	// for the authenticated user in the database
-	user, err := apiCfg.DB.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          params.Email,
+	user, err := apiCfg.DB.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             authUser.ID,
 		HashedPassword: hashedPassword,
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+	// Access tokens issued with the old password are revoked
+	// (the client logs in again or refreshes its token)
+	user, err = apiCfg.DB.BumpUserTokenVersion(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	// A new email only becomes the login email once it's verified,
+	// until then it's pending.
+	if params.Email != "" && params.Email != user.Email {
+		user, err = apiCfg.DB.SetUserPendingEmail(r.Context(), database.SetUserPendingEmailParams{
+			ID:           user.ID,
+			PendingEmail: sql.NullString{String: params.Email, Valid: true},
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+			return
+		}
+		// The pending email is saved anyway if it isn't sent (see handlerCreateUser)
+		err = apiCfg.sendEmailVerification(r.Context(), user.ID, params.Email)
+		if err != nil {
+			log.Printf("Couldn't send verification email to user %s: %s", user.ID, err)
+		}
 	}
 
 	// Respond with a 200
@@ -108,6 +140,30 @@ func (apiCfg *apiConfig) handlerEditUser(w http.ResponseWriter, r *http.Request)
 	respondWithJSON(w, http.StatusOK, databaseUserToUser(user))
 }
 
+// checkPasswordPolicy validates a new password against the password policy.
+// If it breaks any rule, it responds with a 400 status code
+// listing the violations and returns false.
+func (apiCfg *apiConfig) checkPasswordPolicy(w http.ResponseWriter, password, email string) bool {
+	violations, err := apiCfg.passwordPolicy.Validate(password, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password", err)
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	type response struct {
+		Error      string                   `json:"error"`
+		Violations []auth.PasswordViolation `json:"violations"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, response{
+		Error:      "Password doesn't meet the password policy",
+		Violations: violations,
+	})
+	return false
+}
+
 // func (apiCfg *apiConfig) handlerGetUser(w http.ResponseWriter, r *http.Request, user database.User) {
 
 // 	respondWithJSON(w, 200, databaseUserToUser(user))
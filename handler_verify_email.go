@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// sendEmailVerification emails a link that verifies the email of the user.
+// The email is the signup email or a pending new one.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	_, err = cfg.DB.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf(
+			"Open this link to verify your email:\n\n%s/api/verify-email?token=%s\n\n"+
+				"It expires in 24 hours. If it wasn't you, ignore this email.",
+			cfg.baseURL, url.QueryEscape(token),
+		),
+	})
+}
+
+// GET /api/verify-email?token=... verifies the email the token was sent to.
+// A verified pending email becomes the login email of the user.
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing token", nil)
+		return
+	}
+
+	verificationToken, err := cfg.DB.UseEmailVerificationToken(r.Context(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Verification token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't use verification token", err)
+		return
+	}
+
+	user, err := cfg.DB.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verificationToken.UserID,
+		Email: verificationToken.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The user changed the pending email again after this token was sent
+		respondWithError(w, http.StatusBadRequest, "Email is no longer pending verification", err)
+		return
+	}
+	if err != nil {
+		// e.g. someone else took the email in the meantime
+		respondWithError(w, http.StatusConflict, "Couldn't verify email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(user))
+}
+
+// POST /api/verify-email/resend sends a new verification link
+// to the pending email of the user, or to their unverified email.
+func (cfg *apiConfig) handlerResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	email := user.PendingEmail.String
+	if !user.PendingEmail.Valid {
+		if user.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+			return
+		}
+		email = user.Email
+	}
+
+	err := cfg.sendEmailVerification(r.Context(), user.ID, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
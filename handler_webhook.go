@@ -4,66 +4,102 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/subscription"
 	"github.com/google/uuid"
 )
 
+// How far the timestamp of a webhook may be from now.
+// Older deliveries (e.g. captured and replayed) are refused.
+const webhookTolerance = 5 * time.Minute
+
 // 8. Webhooks / 1. Webhooks
 func (apiCfg *apiConfig) handlerPolkaWebhookRedChirpy(w http.ResponseWriter, r *http.Request) {
+	// The signature covers the raw body
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read body", err)
+		return
+	}
 
 	// 8. Webhooks / 4. API Keys
-	apiKey, err := auth.GetAPIKey(r.Header)
+	// Polka signs its webhooks with the secret stored in the .env file
+	// (with several secrets while it's rotated).
+	err = auth.VerifyWebhook(r.Header, body, apiCfg.polkaKeys, time.Now(), webhookTolerance)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find api key", err)
-	}
-	// It should ensure that the API key in the header matches the one stored in the .env file.
-	if apiKey != apiCfg.polkaKey {
-		// If it doesn't, the endpoint should respond with a 401 status code.
-		respondWithError(w, http.StatusUnauthorized, "API key is invalid", nil)
+		// If it doesn't match, the endpoint should respond with a 401 status code.
+		respondWithError(w, http.StatusUnauthorized, "Webhook signature is invalid", err)
 		return
 	}
 
 	// It should accept a request of this shape:
 	type parameters struct {
+		// Unique id of the event, the same for every delivery of it
+		ID    string `json:"id"`
 		Event string `json:"event"`
 		Data  struct {
 			UserID uuid.UUID `json:"user_id"`
+			// End of the paid period (upgrades and renewals)
+			PeriodEnd time.Time `json:"period_end"`
 		}
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err = json.Unmarshal(body, &params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
 		return
 	}
-
-	if params.Event != "user.upgraded" {
-		// If the event is anything other than user.upgraded,
-		// the endpoint should immediately respond with a 204 status code
-		// - we don't care about any other events.
-		w.WriteHeader(http.StatusNoContent)
+	if params.ID == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing event id", nil)
 		return
 	}
 
-	// If the event is user.upgraded,
-	// then it should update the user in the database,
-	// and mark that they are a Chirpy Red member.
-	_, err = apiCfg.DB.UpdateUserRed(r.Context(), params.Data.UserID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			// If the user can't be found, the endpoint should respond with a 404 status code.
-			respondWithError(w, http.StatusNotFound, "Couldn't find user", err)
-			return
+	// An event is handled once: redeliveries (and replays) are acknowledged
+	// without doing anything.
+	// It's recorded in the transaction that applies it,
+	// so if applying it fails, Polka's retry is handled.
+	event := subscriptionEvent{
+		UserID:         params.Data.UserID,
+		Event:          params.Event,
+		Source:         subscriptionSourcePolka,
+		WebhookEventID: params.ID,
+		PeriodEnd:      params.Data.PeriodEnd,
+		Payload:        body,
+	}
+	err = apiCfg.withTx(r.Context(), func(q *database.Queries) error {
+		recorded, err := q.RecordWebhookEvent(r.Context(), database.RecordWebhookEventParams{
+			ID:    params.ID,
+			Event: params.Event,
+		})
+		if err != nil || recorded == 0 {
+			return err
+		}
+
+		_, err = applySubscriptionEvent(r.Context(), q, event)
+		if errors.Is(err, subscription.ErrUnknownEvent) {
+			// The endpoint should immediately respond with a 204 status code
+			// for the events we don't care about.
+			return nil
 		}
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// If the user can't be found, the endpoint should respond with a 404 status code.
+		respondWithError(w, http.StatusNotFound, "Couldn't find user", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't handle event", err)
 		return
 	}
 
-	// If the user is upgraded successfully,
+	// If the event is handled successfully,
 	// the endpoint should respond with a 204 status code and an empty response body.
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,17 +1,17 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenType string
@@ -20,30 +20,95 @@ const (
 	// TokenTypeAccess -
 	// Set the Issuer to "chirpy"
 	TokenTypeAccess TokenType = "chirpy-access"
+	// TokenTypeMFA - short-lived token proving the password was checked,
+	// exchanged with a 2FA code for the access token
+	TokenTypeMFA TokenType = "chirpy-mfa"
 )
 
+// RoleAdmin is the role of the users allowed on the /admin/* routes
+const RoleAdmin = "admin"
+
+// Scopes limit what a token may be used for.
+// Access tokens issued at login are unscoped: they can do anything the user can.
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+)
+
+// Scopes lists the known scopes
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite}
+
+// ValidScope reports whether the scope is known.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the claims of a Chirpy access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	// Roles of the user, carried as a custom claim
+	Roles []string `json:"roles,omitempty"`
+	// Scopes of a scoped token, nil for an unscoped one
+	Scopes []string `json:"scopes,omitempty"`
+	// Token version of the user when the token was issued.
+	// Bumping the user's version revokes all its tokens.
+	TokenVersion int32 `json:"token_version"`
+}
+
+// Scoped reports whether the token is limited to its scopes.
+func (c *Claims) Scoped() bool {
+	return c.Scopes != nil
+}
+
+// HasScope reports whether the token may be used for the scope.
+// Unscoped tokens may be used for everything.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.Scoped() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the claims carry the role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // ErrNoAuthHeaderIncluded -
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
 // 6. Authentication / 1. Authentication with Passwords
-// Hash the password using the bcrypt.GenerateFromPassword function
-// HashPassword -
+// HashPassword hashes a password with argon2id and the default parameters
+// (see Argon2Params.HashPassword for other parameters).
 func HashPassword(password string) (string, error) {
-	dat, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-
-	return string(dat), nil
+	return DefaultArgon2Params.HashPassword(password)
 }
 
 // 6. Authentication / 1. Authentication with Passwords
-// Use the bcrypt.CompareHashAndPassword function
-// to compare the password that the user entered in the HTTP request
+// Compare the password that the user entered in the HTTP request
 // with the password that is stored in the database.
+// Both argon2id hashes and older bcrypt hashes are understood.
 // CheckPasswordHash -
 func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return checkArgon2Hash(password, hash)
+	}
+	return checkBcryptHash(password, hash)
 }
 
 // 6. Authentication / 6. JWTs
@@ -54,70 +119,16 @@ func MakeJWT(
 	tokenSecret string,
 	expiresIn time.Duration,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-	// Use jwt.NewWithClaims to create a new token
-	token := jwt.NewWithClaims(
-		// Use jwt.SigningMethodHS256 as the signing method.
-		jwt.SigningMethodHS256,
-		// Use jwt.RegisteredClaims as the claims
-		jwt.RegisteredClaims{
-			Issuer: string(TokenTypeAccess),
-			// Set IssuedAt to the current time in UTC
-			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-			// Set ExpiresAt to the current time plus the expiration time (expiresIn)
-			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-			// Set the Subject to a stringified version of the user's id
-			Subject: userID.String(),
-		})
-	// Use token.SignedString to sign the token with the secret key.
-	return token.SignedString(signingKey)
+	// Tokens signed with a single secret use HS256 and carry no kid,
+	// see KeySet for RS256/EdDSA keys and key rotation.
+	return NewHMACKeySet(tokenSecret).MakeJWT(userID, nil, 0, expiresIn)
 }
 
 // 6. Authentication / 6. JWTs
 // Add a ValidateJWT function to your auth package:
 // ValidateJWT -
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	// Use the jwt.ParseWithClaims function
-	// to validate the signature of the JWT and extract the claims
-	// into a *jwt.Token struct.
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(tokenSecret), nil
-		},
-	)
-	if err != nil {
-		// An error will be returned if the token is invalid or has expired.
-		// If the token is invalid,
-		// return a 401 Unauthorized response from your handler.
-		return uuid.Nil, err
-	}
-
-	// If all is well with the token,
-	// use the token.Claims interface
-	// to get access to the user's id from the claims
-	// (which should be stored in the Subject field).
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil {
-		return uuid.Nil, err
-	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
-	}
-
-	id, err := uuid.Parse(userIDString)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
-	}
-	// Return the id as a uuid.UUID
-	return id, nil
+	return NewHMACKeySet(tokenSecret).ValidateJWT(tokenString)
 }
 
 // 6. Authentication / 1. Authentication with JWTs
@@ -159,21 +170,50 @@ func MakeRefreshToken() (string, error) {
 	return refreshToken, nil
 }
 
-// 8. Webhooks / 4. API Keys
-// Add a func GetAPIKey(headers http.Header) (string, error)
-// to your auth package.
-func GetAPIKey(headers http.Header) (string, error) {
-	//  It should extract the api key from the Authorization header
-	authHeader := headers.Get("Authorization")
-	if authHeader == "" {
-		return "", ErrNoAuthHeaderIncluded
+// RefreshTokenPrefixLength is the number of plaintext characters
+// of a refresh token kept in the database to identify it.
+const RefreshTokenPrefixLength = 8
+
+// HashRefreshToken returns the keyed hash (hex-encoded HMAC-SHA256)
+// of a refresh token. Only the hash is stored in the database,
+// so a leaked database doesn't hand out live sessions.
+func HashRefreshToken(token, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RefreshTokenPrefix returns the plaintext prefix of a refresh token
+// stored next to its hash.
+func RefreshTokenPrefix(token string) string {
+	if len(token) < RefreshTokenPrefixLength {
+		return token
 	}
-	// You'll need to strip out the ApiKey part
-	// and the whitespace and return just the key.
-	splitAuth := strings.Split(authHeader, " ")
-	if len(splitAuth) < 2 || splitAuth[0] != "ApiKey" {
-		return "", errors.New("malformed authorization header")
+	return token[:RefreshTokenPrefixLength]
+}
+
+// HashToken returns the hex-encoded SHA-256 of a random single-use token
+// (e.g. a password reset token), so only the hash is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix starts every personal access token,
+// so they are told apart from JWTs (and found by secret scanners).
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a new random personal access token.
+// Store it with HashToken.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
 	}
+	return PersonalAccessTokenPrefix + token, nil
+}
 
-	return splitAuth[1], nil
+// IsPersonalAccessToken reports whether a bearer token is a personal access token.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
 }
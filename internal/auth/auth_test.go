@@ -157,3 +157,68 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() error = %v", err)
+	}
+
+	hash := HashRefreshToken(token, "key")
+	if hash == token {
+		t.Errorf("HashRefreshToken() returned the plaintext token")
+	}
+	if got := HashRefreshToken(token, "key"); got != hash {
+		t.Errorf("HashRefreshToken() is not deterministic: %v != %v", got, hash)
+	}
+	if got := HashRefreshToken(token, "other_key"); got == hash {
+		t.Errorf("HashRefreshToken() doesn't depend on the key")
+	}
+	if got := RefreshTokenPrefix(token); got != token[:RefreshTokenPrefixLength] {
+		t.Errorf("RefreshTokenPrefix() = %v, want %v", got, token[:RefreshTokenPrefixLength])
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() error = %v", err)
+	}
+	hash := HashToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Errorf("HashToken() = %v, want a hex SHA-256", hash)
+	}
+	if got := HashToken(token); got != hash {
+		t.Errorf("HashToken() is not deterministic: %v != %v", got, hash)
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false", token)
+	}
+	jwt, _ := MakeJWT(uuid.New(), "secret", time.Hour)
+	if IsPersonalAccessToken(jwt) {
+		t.Errorf("IsPersonalAccessToken() = true for a JWT")
+	}
+}
+
+func TestClaimsHasScope(t *testing.T) {
+	unscoped := Claims{}
+	scoped := Claims{Scopes: []string{ScopeChirpsRead}}
+	empty := Claims{Scopes: []string{}}
+
+	if !unscoped.HasScope(ScopeChirpsWrite) {
+		t.Errorf("unscoped HasScope() = false")
+	}
+	if !scoped.HasScope(ScopeChirpsRead) || scoped.HasScope(ScopeChirpsWrite) {
+		t.Errorf("scoped HasScope() doesn't follow its scopes")
+	}
+	if empty.HasScope(ScopeChirpsRead) {
+		t.Errorf("HasScope() = true for a token without scopes")
+	}
+}
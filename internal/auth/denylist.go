@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist is an in-memory set of revoked access tokens (by jti),
+// so checking a token doesn't hit the database.
+// A token only needs to stay listed until it expires.
+type Denylist struct {
+	mu   sync.RWMutex
+	jtis map[string]time.Time
+}
+
+// NewDenylist returns an empty denylist.
+func NewDenylist() *Denylist {
+	return &Denylist{jtis: map[string]time.Time{}}
+}
+
+// Add revokes the token with the jti until it expires.
+func (d *Denylist) Add(jti string, expiresAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.jtis[jti] = expiresAt
+}
+
+// Contains reports whether the token with the jti is revoked.
+func (d *Denylist) Contains(jti string) bool {
+	if jti == "" {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiresAt, ok := d.jtis[jti]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Prune forgets the tokens that expired before now.
+func (d *Denylist) Prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for jti, expiresAt := range d.jtis {
+		if !now.Before(expiresAt) {
+			delete(d.jtis, jti)
+		}
+	}
+}
+
+// Len returns the number of listed tokens.
+func (d *Denylist) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.jtis)
+}
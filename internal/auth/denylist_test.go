@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDenylist(t *testing.T) {
+	d := NewDenylist()
+	d.Add("revoked", time.Now().Add(time.Hour))
+	d.Add("expired", time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name string
+		jti  string
+		want bool
+	}{
+		{
+			name: "Revoked token",
+			jti:  "revoked",
+			want: true,
+		},
+		{
+			name: "Expired token",
+			jti:  "expired",
+			want: false,
+		},
+		{
+			name: "Other token",
+			jti:  "other",
+			want: false,
+		},
+		{
+			name: "Token without jti",
+			jti:  "",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.Contains(tt.jti); got != tt.want {
+				t.Errorf("Contains(%q) = %v, want %v", tt.jti, got, tt.want)
+			}
+		})
+	}
+
+	d.Prune(time.Now())
+	if d.Len() != 1 {
+		t.Errorf("Len() after Prune() = %d, want 1", d.Len())
+	}
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ActiveKeyFile is the name of the file in a key directory
+// that holds the kid of the key used to sign new tokens.
+// All other keys in the directory are retiring:
+// they still verify tokens but don't sign new ones.
+const ActiveKeyFile = "active"
+
+// SigningKey is a single JWT key of a KeySet.
+type SigningKey struct {
+	// ID is sent as the kid header of the tokens signed with the key
+	ID     string
+	Method jwt.SigningMethod
+	// signKey and verifyKey are the same []byte for HS256
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds the keys that sign and verify access tokens.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewHMACKeySet returns a key set with a single HS256 key
+// that signs tokens without a kid header
+// (the way tokens were signed with JWT_SECRET).
+func NewHMACKeySet(secret string) *KeySet {
+	key := NewHMACKey("", secret)
+	return &KeySet{
+		active: key,
+		keys:   map[string]*SigningKey{key.ID: key},
+	}
+}
+
+// LoadKeySet loads the keys from a directory.
+// The kid of a key is its file name without the extension:
+//   - <kid>.pem holds a PKCS#8 (or PKCS#1) RSA or Ed25519 private key
+//   - <kid>.secret holds an HS256 secret
+//
+// The file named ActiveKeyFile holds the kid of the signing key,
+// it may be omitted if the directory holds a single key.
+func LoadKeySet(dir string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		kid := strings.TrimSuffix(name, ext)
+		if ext != ".pem" && ext != ".secret" {
+			continue
+		}
+		dat, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var key *SigningKey
+		if ext == ".pem" {
+			key, err = parsePrivateKey(kid, dat)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", name, err)
+			}
+		} else {
+			key = NewHMACKey(kid, strings.TrimSpace(string(dat)))
+		}
+		ks.keys[kid] = key
+	}
+	if len(ks.keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", dir)
+	}
+
+	activeKID, err := os.ReadFile(filepath.Join(dir, ActiveKeyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		if len(ks.keys) > 1 {
+			return nil, fmt.Errorf("%s has several keys but no %s file", dir, ActiveKeyFile)
+		}
+		for _, key := range ks.keys {
+			ks.active = key
+		}
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	active, ok := ks.keys[strings.TrimSpace(string(activeKID))]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found in %s", strings.TrimSpace(string(activeKID)), dir)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// AddKey adds a verify-only key to the key set
+// (e.g. the HS256 JWT_SECRET while its tokens are still alive).
+func (ks *KeySet) AddKey(key *SigningKey) {
+	ks.keys[key.ID] = key
+}
+
+// NewHMACKey returns an HS256 key. Tokens signed by a key
+// with an empty kid don't carry a kid header.
+func NewHMACKey(kid, secret string) *SigningKey {
+	return &SigningKey{
+		ID:        kid,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+func parsePrivateKey(kid string, dat []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var privateKey crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{
+			ID:        kid,
+			Method:    jwt.SigningMethodRS256,
+			signKey:   k,
+			verifyKey: &k.PublicKey,
+		}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{
+			ID:        kid,
+			Method:    jwt.SigningMethodEdDSA,
+			signKey:   k,
+			verifyKey: k.Public(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+}
+
+// MakeJWT signs an access token with the active key of the key set.
+// The roles and the token version of the user are carried as claims.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, roles []string, tokenVersion int32, expiresIn time.Duration) (string, error) {
+	return ks.makeToken(TokenTypeAccess, userID, Claims{
+		Roles:        roles,
+		TokenVersion: tokenVersion,
+	}, expiresIn)
+}
+
+// MakeScopedJWT signs an access token limited to the scopes
+// (e.g. one issued to an OAuth client). It never carries roles.
+func (ks *KeySet) MakeScopedJWT(userID uuid.UUID, scopes []string, tokenVersion int32, expiresIn time.Duration) (string, error) {
+	// A token without scopes would be read back as an unscoped one
+	if len(scopes) == 0 {
+		return "", errors.New("a scoped token needs at least one scope")
+	}
+	return ks.makeToken(TokenTypeAccess, userID, Claims{
+		Scopes:       scopes,
+		TokenVersion: tokenVersion,
+	}, expiresIn)
+}
+
+// MakeMFAToken signs the MFA challenge token
+// of a user whose password was checked.
+// It isn't an access token: only ValidateMFAToken accepts it.
+func (ks *KeySet) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.makeToken(TokenTypeMFA, userID, Claims{}, expiresIn)
+}
+
+// makeToken signs the custom claims of a token
+// with its registered claims filled in.
+func (ks *KeySet) makeToken(tokenType TokenType, userID uuid.UUID, claims Claims, expiresIn time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer: string(tokenType),
+		// Set IssuedAt to the current time in UTC
+		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+		// Set ExpiresAt to the current time plus the expiration time (expiresIn)
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		// Set the Subject to a stringified version of the user's id
+		Subject: userID.String(),
+		// A unique jti lets a single token be revoked (see Denylist)
+		ID: uuid.NewString(),
+	}
+	// Use jwt.NewWithClaims to create a new token
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	if ks.active.ID != "" {
+		token.Header["kid"] = ks.active.ID
+	}
+	return token.SignedString(ks.active.signKey)
+}
+
+// ValidateJWT validates an access token with the key named by its kid header
+// and returns the user's id.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+// ParseJWT validates an access token with the key named by its kid header
+// and returns its claims.
+func (ks *KeySet) ParseJWT(tokenString string) (*Claims, error) {
+	return ks.parseToken(TokenTypeAccess, tokenString)
+}
+
+// ValidateMFAToken validates an MFA challenge token
+// and returns the user's id.
+func (ks *KeySet) ValidateMFAToken(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.parseToken(TokenTypeMFA, tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+func (ks *KeySet) parseToken(tokenType TokenType, tokenString string) (*Claims, error) {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		ks.keyFunc,
+		// Tokens of one type are never accepted as another
+		jwt.WithIssuer(string(tokenType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// UserID returns the user's id stored in the Subject claim.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, nil
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// The algorithm is fixed by the key, never by the token,
+	// so a public key can't be used as an HMAC secret.
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA public key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the key set,
+// so other services can verify access tokens offline.
+// HS256 secrets are never published.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+		}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
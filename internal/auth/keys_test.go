@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, kid string, privateKey interface{}) {
+	t.Helper()
+	dat, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: dat})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), block, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeKey(t, dir, "rsa-1", rsaKey)
+	writeKey(t, dir, "ed-1", edKey)
+	os.WriteFile(filepath.Join(dir, "hs-1.secret"), []byte("secret\n"), 0600)
+
+	userID := uuid.New()
+	for _, kid := range []string{"rsa-1", "ed-1", "hs-1"} {
+		t.Run(kid, func(t *testing.T) {
+			os.WriteFile(filepath.Join(dir, ActiveKeyFile), []byte(kid), 0600)
+			ks, err := LoadKeySet(dir)
+			if err != nil {
+				t.Fatalf("LoadKeySet() error = %v", err)
+			}
+			token, err := ks.MakeJWT(userID, []string{RoleAdmin}, 0, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+			gotUserID, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("ValidateJWT() error = %v", err)
+			}
+			if gotUserID != userID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, userID)
+			}
+			// Tokens of a retiring key stay valid after the rotation
+			os.WriteFile(filepath.Join(dir, ActiveKeyFile), []byte("rsa-1"), 0600)
+			rotated, err := LoadKeySet(dir)
+			if err != nil {
+				t.Fatalf("LoadKeySet() error = %v", err)
+			}
+			if _, err := rotated.ValidateJWT(token); err != nil {
+				t.Errorf("ValidateJWT() after rotation error = %v", err)
+			}
+			// Tokens of another key set are rejected
+			if _, err := NewHMACKeySet("secret").ValidateJWT(token); err == nil {
+				t.Errorf("ValidateJWT() with a foreign key set error = nil")
+			}
+		})
+	}
+
+	ks, err := LoadKeySet(dir)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	// The HS256 secret is never published
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks.Keys))
+	}
+	if jwks.Keys[0].KeyID != "ed-1" || jwks.Keys[0].KeyType != "OKP" {
+		t.Errorf("JWKS() key 0 = %+v, want the Ed25519 key", jwks.Keys[0])
+	}
+	if jwks.Keys[1].KeyID != "rsa-1" || jwks.Keys[1].KeyType != "RSA" {
+		t.Errorf("JWKS() key 1 = %+v, want the RSA key", jwks.Keys[1])
+	}
+}
+
+func TestLoadKeySetWithoutActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.secret"), []byte("a"), 0600)
+	if _, err := LoadKeySet(dir); err != nil {
+		t.Errorf("LoadKeySet() with a single key error = %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "b.secret"), []byte("b"), 0600)
+	if _, err := LoadKeySet(dir); err == nil {
+		t.Errorf("LoadKeySet() with several keys and no active file error = nil")
+	}
+}
+
+func TestParseJWTRoles(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	userID := uuid.New()
+
+	token, err := ks.MakeJWT(userID, []string{RoleAdmin}, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ks.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if !claims.HasRole(RoleAdmin) {
+		t.Errorf("ParseJWT() roles = %v, want %v", claims.Roles, []string{RoleAdmin})
+	}
+
+	token, err = ks.MakeJWT(userID, nil, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err = ks.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.HasRole(RoleAdmin) {
+		t.Errorf("ParseJWT() roles = %v, want none", claims.Roles)
+	}
+}
+
+func TestJWTRevocationClaims(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	userID := uuid.New()
+
+	token, err := ks.MakeJWT(userID, nil, 3, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ks.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.TokenVersion != 3 {
+		t.Errorf("ParseJWT() token version = %d, want 3", claims.TokenVersion)
+	}
+
+	other, _ := ks.MakeJWT(userID, nil, 3, time.Hour)
+	otherClaims, _ := ks.ParseJWT(other)
+	if claims.ID == "" || claims.ID == otherClaims.ID {
+		t.Errorf("ParseJWT() jti = %q and %q, want unique ids", claims.ID, otherClaims.ID)
+	}
+}
+
+func TestScopedJWT(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	userID := uuid.New()
+
+	token, err := ks.MakeScopedJWT(userID, []string{ScopeChirpsRead}, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() error = %v", err)
+	}
+	claims, err := ks.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if !claims.Scoped() || !claims.HasScope(ScopeChirpsRead) || claims.HasScope(ScopeChirpsWrite) {
+		t.Errorf("ParseJWT() scopes = %v, want %v", claims.Scopes, []string{ScopeChirpsRead})
+	}
+
+	if _, err := ks.MakeScopedJWT(userID, nil, 0, time.Hour); err == nil {
+		t.Errorf("MakeScopedJWT() without scopes error = nil")
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	userID := uuid.New()
+
+	mfaToken, err := ks.MakeMFAToken(userID, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAToken() error = %v", err)
+	}
+	gotUserID, err := ks.ValidateMFAToken(mfaToken)
+	if err != nil || gotUserID != userID {
+		t.Errorf("ValidateMFAToken() = %v, %v, want %v", gotUserID, err, userID)
+	}
+	// MFA tokens are not access tokens and the other way around
+	if _, err := ks.ValidateJWT(mfaToken); err == nil {
+		t.Errorf("ValidateJWT() accepted an MFA token")
+	}
+	accessToken, _ := ks.MakeJWT(userID, nil, 0, time.Minute)
+	if _, err := ks.ValidateMFAToken(accessToken); err == nil {
+		t.Errorf("ValidateMFAToken() accepted an access token")
+	}
+}
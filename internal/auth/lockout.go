@@ -0,0 +1,32 @@
+package auth
+
+import "time"
+
+// LockoutPolicy describes how long logins are locked
+// after repeated failed attempts.
+type LockoutPolicy struct {
+	// Failed attempts allowed before the first lockout
+	Threshold int
+	// Lockout after the Threshold-th failed attempt,
+	// it doubles with every further failed attempt
+	BaseDelay time.Duration
+	// Upper bound of the lockout
+	MaxDelay time.Duration
+}
+
+// Lockout returns how long logins are locked
+// after failedAttempts consecutive failed attempts
+// (zero while under the threshold).
+func (p LockoutPolicy) Lockout(failedAttempts int) time.Duration {
+	if failedAttempts < p.Threshold {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failedAttempts; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := LockoutPolicy{
+		Threshold: 5,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+	}
+
+	tests := []struct {
+		name           string
+		failedAttempts int
+		want           time.Duration
+	}{
+		{
+			name:           "Under the threshold",
+			failedAttempts: 4,
+			want:           0,
+		},
+		{
+			name:           "At the threshold",
+			failedAttempts: 5,
+			want:           time.Second,
+		},
+		{
+			name:           "Doubles after the threshold",
+			failedAttempts: 7,
+			want:           4 * time.Second,
+		},
+		{
+			name:           "Capped",
+			failedAttempts: 100,
+			want:           time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Lockout(tt.failedAttempts); got != tt.want {
+				t.Errorf("Lockout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are stored in a self-describing format:
+// bcrypt hashes start with $2a$ (or $2b$/$2y$),
+// argon2id hashes use the PHC string format
+// $argon2id$v=19$m=<memory KiB>,t=<time>,p=<threads>$<salt>$<hash>.
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// ErrPasswordMismatch is returned when a password doesn't match its hash
+var ErrPasswordMismatch = errors.New("password doesn't match the hash")
+
+// Argon2Params are the argon2id parameters of new password hashes.
+type Argon2Params struct {
+	// Memory in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id
+var DefaultArgon2Params = Argon2Params{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 2,
+}
+
+// Validate returns an error if argon2id can't hash with the parameters
+// (argon2.IDKey panics on them).
+func (p Argon2Params) Validate() error {
+	if p.Time < 1 {
+		return errors.New("argon2 time must be at least 1")
+	}
+	if p.Threads < 1 {
+		return errors.New("argon2 threads must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return fmt.Errorf("argon2 memory must be at least %d KiB (8 KiB per thread)", 8*uint32(p.Threads))
+	}
+	return nil
+}
+
+// HashPassword hashes a password with argon2id.
+func (p Argon2Params) HashPassword(password string) (string, error) {
+	err := p.Validate()
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, argon2SaltLength)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, argon2KeyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// NeedsRehash reports whether a hash was made with another algorithm
+// or other parameters, and should be replaced
+// the next time the password is known (at login).
+func (p Argon2Params) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return params != p
+}
+
+func decodeArgon2Hash(hash string) (params Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, errors.New("not an argon2id hash")
+	}
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	// A stored hash with such parameters would make the check panic
+	err = params.Validate()
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+func checkArgon2Hash(password, hash string) error {
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	got := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func checkBcryptHash(password, hash string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
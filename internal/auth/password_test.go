@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2Params(t *testing.T) {
+	params := Argon2Params{Memory: 8 * 1024, Time: 1, Threads: 1}
+	hash, err := params.HashPassword("correctPassword123!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Errorf("HashPassword() = %v, want an argon2id PHC string", hash)
+	}
+	if err := CheckPasswordHash("correctPassword123!", hash); err != nil {
+		t.Errorf("CheckPasswordHash() error = %v", err)
+	}
+	if err := CheckPasswordHash("wrongPassword", hash); err == nil {
+		t.Errorf("CheckPasswordHash() accepted a wrong password")
+	}
+
+	// Passwords longer than bcrypt's 72 bytes aren't truncated
+	long := strings.Repeat("a", 80)
+	hash, _ = params.HashPassword(long + "1")
+	if err := CheckPasswordHash(long+"2", hash); err == nil {
+		t.Errorf("CheckPasswordHash() truncated a long password")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	params := Argon2Params{Memory: 8 * 1024, Time: 1, Threads: 1}
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	argon2Hash, _ := params.HashPassword("password")
+	weakerHash, _ := Argon2Params{Memory: 4 * 1024, Time: 1, Threads: 1}.HashPassword("password")
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{
+			name: "bcrypt hash",
+			hash: string(bcryptHash),
+			want: true,
+		},
+		{
+			name: "Current parameters",
+			hash: argon2Hash,
+			want: false,
+		},
+		{
+			name: "Other parameters",
+			hash: weakerHash,
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := params.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// bcrypt hashes still verify
+	if err := CheckPasswordHash("password", string(bcryptHash)); err != nil {
+		t.Errorf("CheckPasswordHash() with a bcrypt hash error = %v", err)
+	}
+}
+
+func TestArgon2ParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Argon2Params
+		wantErr bool
+	}{
+		{name: "Default", params: DefaultArgon2Params, wantErr: false},
+		{name: "Smallest", params: Argon2Params{Memory: 8, Time: 1, Threads: 1}, wantErr: false},
+		{name: "No time", params: Argon2Params{Memory: 64 * 1024, Time: 0, Threads: 2}, wantErr: true},
+		{name: "No threads", params: Argon2Params{Memory: 64 * 1024, Time: 3, Threads: 0}, wantErr: true},
+		{name: "Too little memory", params: Argon2Params{Memory: 15, Time: 3, Threads: 2}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A hash with invalid parameters is rejected instead of panicking
+	hash := "$argon2id$v=19$m=65536,t=0,p=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	if err := CheckPasswordHash("password", hash); err == nil {
+		t.Errorf("CheckPasswordHash() with t=0 error = nil")
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// PKCEMethodS256 is the only PKCE (RFC 7636) code challenge method accepted:
+// the "plain" method would hand the verifier to whoever sees the challenge.
+const PKCEMethodS256 = "S256"
+
+// PKCEChallenge returns the S256 code challenge of a code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidPKCEChallenge reports whether a code challenge
+// is a well-formed S256 challenge (an unpadded base64url SHA-256).
+func ValidPKCEChallenge(challenge string) bool {
+	dat, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(dat) == sha256.Size
+}
+
+// VerifyPKCE reports whether the code verifier sent with an authorization code
+// matches the S256 code challenge sent when the code was requested.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !validPKCEVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// A verifier is 43 to 128 unreserved characters
+func validPKCEVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
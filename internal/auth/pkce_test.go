@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// The example of RFC 7636 Appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("PKCEChallenge() = %v, want %v", got, challenge)
+	}
+	if !ValidPKCEChallenge(challenge) {
+		t.Errorf("ValidPKCEChallenge(%q) = false", challenge)
+	}
+	if ValidPKCEChallenge(verifier[:20]) {
+		t.Errorf("ValidPKCEChallenge() accepted a short challenge")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{
+			name:     "Matching verifier",
+			verifier: verifier,
+			want:     true,
+		},
+		{
+			name:     "Other verifier",
+			verifier: strings.Repeat("a", 43),
+			want:     false,
+		},
+		{
+			name:     "Challenge sent as verifier",
+			verifier: challenge,
+			want:     false,
+		},
+		{
+			name:     "Too short",
+			verifier: "short",
+			want:     false,
+		},
+		{
+			name:     "Too long",
+			verifier: strings.Repeat("a", 129),
+			want:     false,
+		},
+		{
+			name:     "Reserved characters",
+			verifier: verifier[:42] + "/",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
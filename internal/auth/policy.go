@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// PasswordViolation is a rule of the password policy a password breaks.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy describes which passwords users may choose.
+type PasswordPolicy struct {
+	MinLength int
+	// Number of character classes (lowercase, uppercase, digits, symbols)
+	// a password must contain
+	MinCharacterClasses int
+	// Optional list of breached passwords
+	Breached *BreachedPasswords
+}
+
+// DefaultPasswordPolicy only requires a length, as NIST SP 800-63B recommends
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+}
+
+// Validate returns the rules the password breaks (none if it's acceptable).
+// email is the email of the account, passwords derived from it are rejected.
+func (p PasswordPolicy) Validate(password, email string) ([]PasswordViolation, error) {
+	violations := []PasswordViolation{}
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_short",
+			Message: "Password is too short",
+		})
+	}
+
+	if countCharacterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    "character_classes",
+			Message: "Password needs more kinds of characters (lowercase, uppercase, digits, symbols)",
+		})
+	}
+
+	if derivedFromEmail(password, email) {
+		violations = append(violations, PasswordViolation{
+			Code:    "contains_email",
+			Message: "Password must not contain the email",
+		})
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    "breached",
+				Message: "Password appears in a list of breached passwords",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+func countCharacterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func derivedFromEmail(password, email string) bool {
+	if email == "" || password == "" {
+		return false
+	}
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+	if strings.Contains(password, email) {
+		return true
+	}
+	// The local part is only checked when it's long enough to matter
+	localPart, _, _ := strings.Cut(email, "@")
+	return len(localPart) >= 3 && strings.Contains(password, localPart)
+}
+
+// BreachedPasswords is a local copy of a breached password list
+// in the k-anonymity range format of Pwned Passwords:
+// the directory holds one file per 5 hex character prefix of the SHA-1
+// (named <PREFIX> or <PREFIX>.txt), with a <SUFFIX>:<COUNT> line
+// for every breached password hash starting with the prefix.
+// Files are read on demand, the list is never loaded whole.
+type BreachedPasswords struct {
+	dir string
+}
+
+// LoadBreachedPasswords returns the breached password list in dir.
+func LoadBreachedPasswords(dir string) (*BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	return &BreachedPasswords{dir: dir}, nil
+}
+
+// Contains reports whether the password is in the list.
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(b.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries of the range API have a count of 0
+		if strings.EqualFold(lineSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
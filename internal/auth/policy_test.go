@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(
+		"0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n"+
+			"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n",
+	), 0600)
+	breached, err := LoadBreachedPasswords(dir)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords() error = %v", err)
+	}
+
+	policy := PasswordPolicy{
+		MinLength:           8,
+		MinCharacterClasses: 2,
+		Breached:            breached,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{
+			name:     "Acceptable password",
+			password: "correct horse battery staple",
+			email:    "a@example.com",
+			want:     []string{},
+		},
+		{
+			name:     "Empty password",
+			password: "",
+			email:    "a@example.com",
+			want:     []string{"too_short", "character_classes"},
+		},
+		{
+			name:     "Single character class",
+			password: "abcdefghij",
+			email:    "a@example.com",
+			want:     []string{"character_classes"},
+		},
+		{
+			name:     "Derived from the email",
+			password: "walter1234!",
+			email:    "Walter@example.com",
+			want:     []string{"contains_email"},
+		},
+		{
+			name:     "Breached password",
+			password: "password",
+			email:    "a@example.com",
+			want:     []string{"character_classes", "breached"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Validate(tt.password, tt.email)
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			got := []string{}
+			for _, v := range violations {
+				got = append(got, v.Code)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Validate() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
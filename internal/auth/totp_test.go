@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vector of RFC 6238 (SHA1, the secret "12345678901234567890")
+func TestTOTPCode(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, TOTPStep(now))
+	previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+	old, _ := TOTPCode(secret, TOTPStep(now)-5)
+
+	if step, ok := ValidateTOTP(secret, code, now); !ok || step != TOTPStep(now) {
+		t.Errorf("ValidateTOTP() current code = %v, %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, previous, now); !ok {
+		t.Errorf("ValidateTOTP() rejected the code of the previous period")
+	}
+	if _, ok := ValidateTOTP(secret, old, now); ok && old != code {
+		t.Errorf("ValidateTOTP() accepted an old code")
+	}
+	if _, ok := ValidateTOTP(secret, "abcdef", now); ok {
+		t.Errorf("ValidateTOTP() accepted an invalid code")
+	}
+
+	uri := TOTPURI("Chirpy", "a@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:a@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("TOTPURI() = %v", uri)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || seen[code] {
+			t.Errorf("GenerateRecoveryCodes() returned %q", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(" "+strings.ToUpper(code)+" ") != code {
+			t.Errorf("NormalizeRecoveryCode() doesn't restore %q", code)
+		}
+	}
+}
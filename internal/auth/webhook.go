@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed webhooks carry the Unix time they were sent at
+// and one or more signatures ("v1=<hex>", comma-separated):
+// the HMAC-SHA256 of "<timestamp>.<body>" with each active secret.
+const (
+	WebhookTimestampHeader = "Polka-Timestamp"
+	WebhookSignatureHeader = "Polka-Signature"
+)
+
+var (
+	ErrWebhookNotSigned        = errors.New("webhook has no timestamp or signature")
+	ErrWebhookTimestamp        = errors.New("webhook timestamp is outside the tolerance")
+	ErrWebhookInvalidSignature = errors.New("webhook signature is invalid")
+)
+
+// SignWebhook returns the hex-encoded signature of a webhook body sent at timestamp.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature headers of a webhook.
+// The timestamp must be within tolerance of now,
+// and one of the signatures must match one of the secrets
+// (several secrets are active while they are rotated).
+func VerifyWebhook(headers http.Header, body []byte, secrets []string, now time.Time, tolerance time.Duration) error {
+	timestampHeader := headers.Get(WebhookTimestampHeader)
+	signatureHeader := headers.Get(WebhookSignatureHeader)
+	if timestampHeader == "" || signatureHeader == "" {
+		return ErrWebhookNotSigned
+	}
+
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrWebhookNotSigned
+	}
+	sentAt := time.Unix(timestamp, 0)
+	if sentAt.Before(now.Add(-tolerance)) || sentAt.After(now.Add(tolerance)) {
+		return ErrWebhookTimestamp
+	}
+
+	for _, secret := range secrets {
+		expected := SignWebhook(secret, timestamp, body)
+		for _, signature := range strings.Split(signatureHeader, ",") {
+			signature, ok := strings.CutPrefix(strings.TrimSpace(signature), "v1=")
+			if !ok {
+				continue
+			}
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return nil
+			}
+		}
+	}
+	return ErrWebhookInvalidSignature
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	now := time.Now()
+	timestamp := now.Unix()
+	signature := SignWebhook("new-secret", timestamp, body)
+	secrets := []string{"old-secret", "new-secret"}
+
+	signed := func(timestamp int64, signatures string) http.Header {
+		headers := http.Header{}
+		headers.Set(WebhookTimestampHeader, fmt.Sprint(timestamp))
+		headers.Set(WebhookSignatureHeader, signatures)
+		return headers
+	}
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		body    []byte
+		secrets []string
+		wantErr error
+	}{
+		{
+			name:    "Valid signature",
+			headers: signed(timestamp, "v1="+signature),
+			body:    body,
+			secrets: secrets,
+			wantErr: nil,
+		},
+		{
+			name:    "One of several signatures",
+			headers: signed(timestamp, "v1=deadbeef, v1="+signature),
+			body:    body,
+			secrets: secrets,
+			wantErr: nil,
+		},
+		{
+			name:    "Retired secret",
+			headers: signed(timestamp, "v1="+signature),
+			body:    body,
+			secrets: []string{"old-secret"},
+			wantErr: ErrWebhookInvalidSignature,
+		},
+		{
+			name:    "Tampered body",
+			headers: signed(timestamp, "v1="+signature),
+			body:    []byte(`{"id":"evt_1","event":"user.downgraded"}`),
+			secrets: secrets,
+			wantErr: ErrWebhookInvalidSignature,
+		},
+		{
+			name:    "Timestamp changed",
+			headers: signed(timestamp+1, "v1="+signature),
+			body:    body,
+			secrets: secrets,
+			wantErr: ErrWebhookInvalidSignature,
+		},
+		{
+			name:    "Too old",
+			headers: signed(now.Add(-10*time.Minute).Unix(), "v1="+SignWebhook("new-secret", now.Add(-10*time.Minute).Unix(), body)),
+			body:    body,
+			secrets: secrets,
+			wantErr: ErrWebhookTimestamp,
+		},
+		{
+			name:    "Signature without version",
+			headers: signed(timestamp, signature),
+			body:    body,
+			secrets: secrets,
+			wantErr: ErrWebhookInvalidSignature,
+		},
+		{
+			name:    "Not signed",
+			headers: http.Header{"Authorization": {"ApiKey new-secret"}},
+			body:    body,
+			secrets: secrets,
+			wantErr: ErrWebhookNotSigned,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhook(tt.headers, tt.body, tt.secrets, now, 5*time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package chirpfilter parses the filters of chirp listings
+// from query parameters.
+// The filters are only values bound to a static query, never SQL.
+package chirpfilter
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limits of the filters
+const (
+	MaxAuthors        = 50
+	MaxContainsLength = 100
+)
+
+// Filter keeps the chirps matching all of its fields.
+// The zero value keeps every chirp.
+type Filter struct {
+	// Authors of the chirps (any of them), all authors if empty
+	AuthorIDs []uuid.UUID
+	// Chirps created at or after, zero for no bound
+	CreatedAfter time.Time
+	// Chirps created before, zero for no bound
+	CreatedBefore time.Time
+	// Text the body contains (case insensitive), empty for any
+	Contains string
+	// Only the chirps of Chirpy Red members
+	RedAuthorsOnly bool
+	// Only replies (true) or only the first chirps of conversations (false),
+	// nil for both
+	IsReply *bool
+	// Only chirps with media (true) or without (false), nil for both
+	HasMedia *bool
+}
+
+// Error is a filter parameter with an invalid value.
+type Error struct {
+	Param   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+// Parse returns the filter of the query parameters:
+//   - author_id: an author, repeated or comma-separated for several
+//   - created_after, created_before: RFC 3339 times or YYYY-MM-DD dates (UTC)
+//   - contains: text of the body
+//   - red_authors: "true" for the chirps of Chirpy Red members only
+//   - is_reply: "true" for replies only, "false" for no replies
+//   - has_media: "true" for chirps with media only, "false" for chirps without
+func Parse(query url.Values) (Filter, error) {
+	filter := Filter{}
+
+	for _, value := range query["author_id"] {
+		for _, s := range strings.Split(value, ",") {
+			authorID, err := uuid.Parse(strings.TrimSpace(s))
+			if err != nil {
+				return Filter{}, &Error{Param: "author_id", Message: fmt.Sprintf("%q is not a user ID", s)}
+			}
+			filter.AuthorIDs = append(filter.AuthorIDs, authorID)
+		}
+	}
+	if len(filter.AuthorIDs) > MaxAuthors {
+		return Filter{}, &Error{Param: "author_id", Message: fmt.Sprintf("at most %d authors", MaxAuthors)}
+	}
+
+	var err error
+	if s := query.Get("created_after"); s != "" {
+		filter.CreatedAfter, err = parseTime(s)
+		if err != nil {
+			return Filter{}, &Error{Param: "created_after", Message: err.Error()}
+		}
+	}
+	if s := query.Get("created_before"); s != "" {
+		filter.CreatedBefore, err = parseTime(s)
+		if err != nil {
+			return Filter{}, &Error{Param: "created_before", Message: err.Error()}
+		}
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() &&
+		!filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return Filter{}, &Error{Param: "created_before", Message: "must be after created_after"}
+	}
+
+	if query.Has("contains") {
+		filter.Contains = strings.TrimSpace(query.Get("contains"))
+		if filter.Contains == "" {
+			return Filter{}, &Error{Param: "contains", Message: "must not be empty"}
+		}
+		if len(filter.Contains) > MaxContainsLength {
+			return Filter{}, &Error{Param: "contains", Message: fmt.Sprintf("at most %d characters", MaxContainsLength)}
+		}
+	}
+
+	if s := query.Get("red_authors"); s != "" {
+		filter.RedAuthorsOnly, err = strconv.ParseBool(s)
+		if err != nil {
+			return Filter{}, &Error{Param: "red_authors", Message: "must be true or false"}
+		}
+	}
+
+	if s := query.Get("is_reply"); s != "" {
+		isReply, err := strconv.ParseBool(s)
+		if err != nil {
+			return Filter{}, &Error{Param: "is_reply", Message: "must be true or false"}
+		}
+		filter.IsReply = &isReply
+	}
+	if s := query.Get("has_media"); s != "" {
+		hasMedia, err := strconv.ParseBool(s)
+		if err != nil {
+			return Filter{}, &Error{Param: "has_media", Message: "must be true or false"}
+		}
+		filter.HasMedia = &hasMedia
+	}
+
+	return filter, nil
+}
+
+// ContainsPattern returns the ILIKE pattern of Contains,
+// with the wildcards of the text escaped.
+// It's empty if Contains is.
+func (f Filter) ContainsPattern() string {
+	if f.Contains == "" {
+		return ""
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Contains)
+	return "%" + escaped + "%"
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or a YYYY-MM-DD date", s)
+}
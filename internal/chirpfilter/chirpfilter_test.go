@@ -0,0 +1,136 @@
+package chirpfilter
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParse(t *testing.T) {
+	isReply := false
+	hasMedia := true
+	author1 := uuid.New()
+	author2 := uuid.New()
+	author3 := uuid.New()
+
+	tests := []struct {
+		name      string
+		query     string
+		want      Filter
+		wantParam string
+	}{
+		{
+			name:  "No filters",
+			query: "",
+			want:  Filter{},
+		},
+		{
+			name:  "Several authors",
+			query: "author_id=" + author1.String() + "," + author2.String() + "&author_id=" + author3.String(),
+			want:  Filter{AuthorIDs: []uuid.UUID{author1, author2, author3}},
+		},
+		{
+			name:  "Time range",
+			query: "created_after=2024-05-01&created_before=2024-05-02T12:00:00%2B02:00",
+			want: Filter{
+				CreatedAfter:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				CreatedBefore: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "Text and Chirpy Red authors",
+			query: "contains=+hello+&red_authors=true",
+			want:  Filter{Contains: "hello", RedAuthorsOnly: true},
+		},
+		{
+			name:  "No replies",
+			query: "is_reply=false",
+			want:  Filter{IsReply: &isReply},
+		},
+		{
+			name:  "With media",
+			query: "has_media=true",
+			want:  Filter{HasMedia: &hasMedia},
+		},
+		{
+			name:      "Invalid author",
+			query:     "author_id=" + author1.String() + ",bob",
+			wantParam: "author_id",
+		},
+		{
+			name:      "Invalid time",
+			query:     "created_after=yesterday",
+			wantParam: "created_after",
+		},
+		{
+			name:      "Empty range",
+			query:     "created_after=2024-05-02&created_before=2024-05-01",
+			wantParam: "created_before",
+		},
+		{
+			name:      "Empty text",
+			query:     "contains=",
+			wantParam: "contains",
+		},
+		{
+			name:      "Invalid flag",
+			query:     "red_authors=maybe",
+			wantParam: "red_authors",
+		},
+		{
+			name:      "Invalid reply flag",
+			query:     "is_reply=yes",
+			wantParam: "is_reply",
+		},
+		{
+			name:      "Invalid media flag",
+			query:     "has_media=some",
+			wantParam: "has_media",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(query)
+			if tt.wantParam != "" {
+				filterErr := &Error{}
+				if !errors.As(err, &filterErr) || filterErr.Param != tt.wantParam {
+					t.Fatalf("Parse() error = %v, want an error of %s", err, tt.wantParam)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		contains string
+		want     string
+	}{
+		{contains: "", want: ""},
+		{contains: "hello", want: "%hello%"},
+		{contains: `100%_sure\`, want: `%100\%\_sure\\%`},
+	}
+
+	for _, tt := range tests {
+		got := Filter{Contains: tt.contains}.ContainsPattern()
+		if got != tt.want {
+			t.Errorf("ContainsPattern(%q) = %q, want %q", tt.contains, got, tt.want)
+		}
+	}
+}
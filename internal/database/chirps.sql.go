@@ -7,27 +7,49 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
-VALUES (
-    gen_random_uuid(), 
-    NOW(), NOW(), $1, $2
-    -- encode(sha256(random()::text::bytea), 'hex')
+WITH parent AS (
+    UPDATE chirps
+    SET reply_count = reply_count + 1
+    WHERE chirps.id = $4
+    RETURNING chirps.id, chirps.root_id, chirps.depth
 )
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, media_url, parent_id, root_id, depth)
+SELECT
+    new_chirp.id,
+    NOW(), NOW(), $1::text, $2::uuid, $3::text,
+    -- encode(sha256(random()::text::bytea), 'hex')
+    parent.id, COALESCE(parent.root_id, new_chirp.id), COALESCE(parent.depth + 1, 0)
+FROM (SELECT gen_random_uuid() AS id) AS new_chirp
+LEFT JOIN parent ON TRUE
+WHERE $4::uuid IS NULL OR parent.id IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, search_vector, edited_at, parent_id, root_id, depth, reply_count, media_url
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+	MediaUrl sql.NullString
+	ParentID uuid.NullUUID
 }
 
+// A reply (with a parent_id) joins the conversation of its parent
+// and is counted in the parent's replies.
+// If the parent doesn't exist (e.g. it was just deleted), nothing is inserted.
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.MediaUrl,
+		arg.ParentID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -35,21 +57,82 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.Depth,
+		&i.ReplyCount,
+		&i.MediaUrl,
 	)
 	return i, err
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id=$1
+WITH deleted AS (
+    DELETE FROM chirps WHERE chirps.id = $1
+    RETURNING chirps.parent_id
+)
+UPDATE chirps
+SET reply_count = reply_count - 1
+WHERE chirps.id IN (SELECT parent_id FROM deleted)
 `
 
+// The parent counts one reply less,
+// the replies of the chirp lose their parent (but stay in the conversation)
 func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, deleteChirp, id)
 	return err
 }
 
+const editChirp = `-- name: EditChirp :one
+WITH locked AS (
+    SELECT chirps.id, chirps.body, COALESCE(chirps.edited_at, chirps.created_at) AS written_at
+    FROM chirps
+    WHERE chirps.id = $1
+    FOR UPDATE
+), revision AS (
+    INSERT INTO chirp_revisions(id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), locked.id, locked.body, locked.written_at, NOW()
+    FROM locked
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW(), edited_at = NOW()
+FROM locked
+WHERE chirps.id = locked.id
+RETURNING chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.edited_at, chirps.parent_id, chirps.root_id, chirps.depth, chirps.reply_count, chirps.media_url
+`
+
+type EditChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+// Replaces the body, keeping the previous one as a revision.
+// The row is locked first: a concurrent edit is waited for,
+// and the body it wrote is the one kept (not the statement's snapshot).
+func (q *Queries) EditChirp(ctx context.Context, arg EditChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, editChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.Depth,
+		&i.ReplyCount,
+		&i.MediaUrl,
+	)
+	return i, err
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, edited_at, parent_id, root_id, depth, reply_count, media_url FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -61,64 +144,93 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.Depth,
+		&i.ReplyCount,
+		&i.MediaUrl,
 	)
 	return i, err
 }
 
-const getChirpsAsc = `-- name: GetChirpsAsc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+const getThreadChirps = `-- name: GetThreadChirps :many
+SELECT
+    -- Not search_vector, which pages of chirps don't need
+    id, created_at, updated_at, body, user_id, media_url, edited_at, parent_id, root_id, depth, reply_count
+FROM chirps
+WHERE root_id = $1
+AND id <> $1
+AND depth <= $2
+AND (
+    $3::timestamp IS NULL
+    OR ($4::bool
+        AND (created_at, id) < ($3, $5::uuid))
+    OR (NOT $4::bool
+        AND (created_at, id) > ($3, $5::uuid))
+)
+ORDER BY
+    CASE WHEN $4::bool THEN created_at END DESC,
+    CASE WHEN $4::bool THEN id END DESC,
+    created_at ASC,
+    id ASC
+LIMIT $6
 `
 
-func (q *Queries) GetChirpsAsc(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsAsc)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Chirp
-	for rows.Next() {
-		var i Chirp
-		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Body,
-			&i.UserID,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+type GetThreadChirpsParams struct {
+	RootID          uuid.UUID
+	MaxDepth        int32
+	CursorCreatedAt sql.NullTime
+	Descending      bool
+	CursorID        uuid.NullUUID
+	Limit           int32
 }
 
-const getChirpsByAuthorAsc = `-- name: GetChirpsByAuthorAsc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id=$1
-ORDER BY created_at ASC
-`
+type GetThreadChirpsRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	MediaUrl   sql.NullString
+	EditedAt   sql.NullTime
+	ParentID   uuid.NullUUID
+	RootID     uuid.UUID
+	Depth      int32
+	ReplyCount int32
+}
 
-func (q *Queries) GetChirpsByAuthorAsc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorAsc, userID)
+// A page of the replies of a conversation ordered by (created_at, id),
+// down to a depth, like ListChirps.
+func (q *Queries) GetThreadChirps(ctx context.Context, arg GetThreadChirpsParams) ([]GetThreadChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getThreadChirps,
+		arg.RootID,
+		arg.MaxDepth,
+		arg.CursorCreatedAt,
+		arg.Descending,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []GetThreadChirpsRow
 	for rows.Next() {
-		var i Chirp
+		var i GetThreadChirpsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.MediaUrl,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.Depth,
+			&i.ReplyCount,
 		); err != nil {
 			return nil, err
 		}
@@ -133,60 +245,98 @@ func (q *Queries) GetChirpsByAuthorAsc(ctx context.Context, userID uuid.UUID) ([
 	return items, nil
 }
 
-const getChirpsByAuthorDesc = `-- name: GetChirpsByAuthorDesc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id=$1
-ORDER BY created_at DESC
+const listChirps = `-- name: ListChirps :many
+SELECT
+    -- Not search_vector, which pages of chirps don't need
+    id, created_at, updated_at, body, user_id, media_url, edited_at, parent_id, root_id, depth, reply_count
+FROM chirps
+WHERE (COALESCE(cardinality($1::uuid[]), 0) = 0 OR user_id = ANY($1::uuid[]))
+AND ($2::timestamp IS NULL OR created_at >= $2)
+AND ($3::timestamp IS NULL OR created_at < $3)
+AND ($4::text IS NULL OR body ILIKE $4)
+AND (NOT $5::bool OR user_id IN (SELECT id FROM users WHERE is_chirpy_red))
+AND ($6::bool IS NULL OR (depth > 0) = $6)
+AND ($7::bool IS NULL OR (media_url IS NOT NULL) = $7)
+AND (
+    $8::timestamp IS NULL
+    OR ($9::bool
+        AND (created_at, id) < ($8, $10::uuid))
+    OR (NOT $9::bool
+        AND (created_at, id) > ($8, $10::uuid))
+)
+ORDER BY
+    CASE WHEN $9::bool THEN created_at END DESC,
+    CASE WHEN $9::bool THEN id END DESC,
+    created_at ASC,
+    id ASC
+LIMIT $11
 `
 
-func (q *Queries) GetChirpsByAuthorDesc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorDesc, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Chirp
-	for rows.Next() {
-		var i Chirp
-		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Body,
-			&i.UserID,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+type ListChirpsParams struct {
+	AuthorIds       []uuid.UUID
+	CreatedAfter    sql.NullTime
+	CreatedBefore   sql.NullTime
+	BodyPattern     sql.NullString
+	RedAuthorsOnly  bool
+	IsReply         sql.NullBool
+	HasMedia        sql.NullBool
+	CursorCreatedAt sql.NullTime
+	Descending      bool
+	CursorID        uuid.NullUUID
+	Limit           int32
 }
 
-const getChirpsDesc = `-- name: GetChirpsDesc :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at DESC
-`
+type ListChirpsRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	MediaUrl   sql.NullString
+	EditedAt   sql.NullTime
+	ParentID   uuid.NullUUID
+	RootID     uuid.UUID
+	Depth      int32
+	ReplyCount int32
+}
 
-func (q *Queries) GetChirpsDesc(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsDesc)
+// A page of chirps ordered by (created_at, id), with optional filters.
+// Without a cursor it starts at the beginning of the order,
+// otherwise right after the cursor.
+// An ILIKE pattern, escaped with backslashes
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]ListChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		pq.Array(arg.AuthorIds),
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.BodyPattern,
+		arg.RedAuthorsOnly,
+		arg.IsReply,
+		arg.HasMedia,
+		arg.CursorCreatedAt,
+		arg.Descending,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []ListChirpsRow
 	for rows.Next() {
-		var i Chirp
+		var i ListChirpsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.MediaUrl,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.Depth,
+			&i.ReplyCount,
 		); err != nil {
 			return nil, err
 		}
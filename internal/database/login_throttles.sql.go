@@ -0,0 +1,109 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: login_throttles.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+const forgiveLoginAttempt = `-- name: ForgiveLoginAttempt :exec
+UPDATE login_throttles
+SET failed_attempts = GREATEST(failed_attempts - 1, 0),
+    locked_until = CASE
+        WHEN failed_attempts - 1 < $1::int THEN NULL
+        ELSE locked_until
+    END
+WHERE key = $2
+`
+
+type ForgiveLoginAttemptParams struct {
+	Threshold int32
+	Key       string
+}
+
+// Uncounts an attempt that turned out right,
+// unlocking the key if it's back under the threshold.
+func (q *Queries) ForgiveLoginAttempt(ctx context.Context, arg ForgiveLoginAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, forgiveLoginAttempt, arg.Threshold, arg.Key)
+	return err
+}
+
+const getLoginThrottle = `-- name: GetLoginThrottle :one
+SELECT key, failed_attempts, locked_until, updated_at FROM login_throttles
+WHERE key = $1
+`
+
+func (q *Queries) GetLoginThrottle(ctx context.Context, key string) (LoginThrottle, error) {
+	row := q.db.QueryRowContext(ctx, getLoginThrottle, key)
+	var i LoginThrottle
+	err := row.Scan(
+		&i.Key,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const lockLogin = `-- name: LockLogin :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE key = $1
+`
+
+type LockLoginParams struct {
+	Key         string
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) LockLogin(ctx context.Context, arg LockLoginParams) error {
+	_, err := q.db.ExecContext(ctx, lockLogin, arg.Key, arg.LockedUntil)
+	return err
+}
+
+const resetLoginThrottle = `-- name: ResetLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1
+`
+
+func (q *Queries) ResetLoginThrottle(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, resetLoginThrottle, key)
+	return err
+}
+
+const takeLoginAttempt = `-- name: TakeLoginAttempt :one
+INSERT INTO login_throttles(key, failed_attempts, locked_until, updated_at)
+VALUES ($1, 1, NULL, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failed_attempts = CASE
+        WHEN login_throttles.locked_until > NOW() THEN login_throttles.failed_attempts
+        WHEN login_throttles.updated_at < NOW() - INTERVAL '1 hour' THEN 1
+        ELSE login_throttles.failed_attempts + 1
+    END,
+    updated_at = CASE
+        WHEN login_throttles.locked_until > NOW() THEN login_throttles.updated_at
+        ELSE NOW()
+    END
+RETURNING key, failed_attempts, locked_until, updated_at
+`
+
+// Counts a login attempt for the key, unless logins are locked
+// (then the row is returned as it is, with its locked_until).
+// Attempts older than an hour don't count anymore.
+// The upsert locks the row until the end of the transaction,
+// so concurrent attempts are counted one after the other.
+func (q *Queries) TakeLoginAttempt(ctx context.Context, key string) (LoginThrottle, error) {
+	row := q.db.QueryRowContext(ctx, takeLoginAttempt, key)
+	var i LoginThrottle
+	err := row.Scan(
+		&i.Key,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
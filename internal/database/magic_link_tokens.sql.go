@@ -0,0 +1,61 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: magic_link_tokens.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createMagicLinkToken = `-- name: CreateMagicLinkToken :one
+INSERT INTO magic_link_tokens(token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+    $1, $2,
+    NOW(), NOW() + INTERVAL '15 minutes', NULL
+)
+RETURNING token_hash, user_id, created_at, expires_at, used_at
+`
+
+type CreateMagicLinkTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) CreateMagicLinkToken(ctx context.Context, arg CreateMagicLinkTokenParams) (MagicLinkToken, error) {
+	row := q.db.QueryRowContext(ctx, createMagicLinkToken, arg.TokenHash, arg.UserID)
+	var i MagicLinkToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const useMagicLinkToken = `-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING token_hash, user_id, created_at, expires_at, used_at
+`
+
+func (q *Queries) UseMagicLinkToken(ctx context.Context, tokenHash string) (MagicLinkToken, error) {
+	row := q.db.QueryRowContext(ctx, useMagicLinkToken, tokenHash)
+	var i MagicLinkToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,126 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: oauth_clients.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients(id, created_at, updated_at, user_id, name, redirect_uris, secret_hash)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(),
+    $1, $2, $3, $4
+)
+RETURNING id, created_at, updated_at, user_id, name, redirect_uris, secret_hash
+`
+
+type CreateOAuthClientParams struct {
+	UserID       uuid.UUID
+	Name         string
+	RedirectUris []string
+	SecretHash   sql.NullString
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.UserID,
+		arg.Name,
+		pq.Array(arg.RedirectUris),
+		arg.SecretHash,
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		pq.Array(&i.RedirectUris),
+		&i.SecretHash,
+	)
+	return i, err
+}
+
+const deleteOAuthClient = `-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1
+AND user_id = $2
+`
+
+type DeleteOAuthClientParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteOAuthClient(ctx context.Context, arg DeleteOAuthClientParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOAuthClient, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, created_at, updated_at, user_id, name, redirect_uris, secret_hash FROM oauth_clients
+WHERE id = $1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id uuid.UUID) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		pq.Array(&i.RedirectUris),
+		&i.SecretHash,
+	)
+	return i, err
+}
+
+const getOAuthClientsByUser = `-- name: GetOAuthClientsByUser :many
+SELECT id, created_at, updated_at, user_id, name, redirect_uris, secret_hash FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetOAuthClientsByUser(ctx context.Context, userID uuid.UUID) ([]OauthClient, error) {
+	rows, err := q.db.QueryContext(ctx, getOAuthClientsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Name,
+			pq.Array(&i.RedirectUris),
+			&i.SecretHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,97 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: oauth_refresh_tokens.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO oauth_refresh_tokens(token_hash, client_id, user_id, scopes, created_at, expires_at, revoked_at)
+VALUES (
+    $1, $2, $3, $4,
+    NOW(), NOW() + INTERVAL '60 days', NULL
+)
+RETURNING token_hash, client_id, user_id, scopes, created_at, expires_at, revoked_at
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	TokenHash string
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	Scopes    []string
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (OauthRefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.TokenHash,
+		arg.ClientID,
+		arg.UserID,
+		pq.Array(arg.Scopes),
+	)
+	var i OauthRefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.ClientID,
+		&i.UserID,
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const revokeOAuthRefreshToken = `-- name: RevokeOAuthRefreshToken :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1
+AND client_id = $2
+AND revoked_at IS NULL
+`
+
+type RevokeOAuthRefreshTokenParams struct {
+	TokenHash string
+	ClientID  uuid.UUID
+}
+
+func (q *Queries) RevokeOAuthRefreshToken(ctx context.Context, arg RevokeOAuthRefreshTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOAuthRefreshToken, arg.TokenHash, arg.ClientID)
+	return err
+}
+
+const rotateOAuthRefreshToken = `-- name: RotateOAuthRefreshToken :one
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1
+AND client_id = $2
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING token_hash, client_id, user_id, scopes, created_at, expires_at, revoked_at
+`
+
+type RotateOAuthRefreshTokenParams struct {
+	TokenHash string
+	ClientID  uuid.UUID
+}
+
+func (q *Queries) RotateOAuthRefreshToken(ctx context.Context, arg RotateOAuthRefreshTokenParams) (OauthRefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateOAuthRefreshToken, arg.TokenHash, arg.ClientID)
+	var i OauthRefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.ClientID,
+		&i.UserID,
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
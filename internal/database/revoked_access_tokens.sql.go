@@ -0,0 +1,75 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: revoked_access_tokens.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteExpiredRevokedAccessTokens = `-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredRevokedAccessTokens(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredRevokedAccessTokens)
+	return err
+}
+
+const getRevokedAccessTokens = `-- name: GetRevokedAccessTokens :many
+SELECT jti, user_id, revoked_at, expires_at FROM revoked_access_tokens
+WHERE revoked_at >= $1
+AND expires_at > NOW()
+`
+
+// Tokens revoked since the last sync that are still alive
+func (q *Queries) GetRevokedAccessTokens(ctx context.Context, revokedAt time.Time) ([]RevokedAccessToken, error) {
+	rows, err := q.db.QueryContext(ctx, getRevokedAccessTokens, revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RevokedAccessToken
+	for rows.Next() {
+		var i RevokedAccessToken
+		if err := rows.Scan(
+			&i.Jti,
+			&i.UserID,
+			&i.RevokedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens(jti, user_id, revoked_at, expires_at)
+VALUES ($1, $2, NOW(), $3)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type RevokeAccessTokenParams struct {
+	Jti       string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeAccessToken, arg.Jti, arg.UserID, arg.ExpiresAt)
+	return err
+}
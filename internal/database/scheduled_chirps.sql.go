@@ -0,0 +1,145 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: scheduled_chirps.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const countRecentChirps = `-- name: CountRecentChirps :one
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1 AND chirps.created_at > $2)
+    + (SELECT COUNT(*) FROM scheduled_chirps WHERE scheduled_chirps.user_id = $1 AND scheduled_chirps.created_at > $2)
+    AS count
+`
+
+type CountRecentChirpsParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+// Chirps posted and scheduled by the user since the time
+func (q *Queries) CountRecentChirps(ctx context.Context, arg CountRecentChirpsParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, countRecentChirps, arg.UserID, arg.CreatedAt)
+	var count int32
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createScheduledChirp = `-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps(id, user_id, body, media_url, publish_at, created_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW()
+)
+RETURNING id, user_id, body, publish_at, created_at, media_url
+`
+
+type CreateScheduledChirpParams struct {
+	UserID    uuid.UUID
+	Body      string
+	MediaUrl  sql.NullString
+	PublishAt time.Time
+}
+
+func (q *Queries) CreateScheduledChirp(ctx context.Context, arg CreateScheduledChirpParams) (ScheduledChirp, error) {
+	row := q.db.QueryRowContext(ctx, createScheduledChirp,
+		arg.UserID,
+		arg.Body,
+		arg.MediaUrl,
+		arg.PublishAt,
+	)
+	var i ScheduledChirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Body,
+		&i.PublishAt,
+		&i.CreatedAt,
+		&i.MediaUrl,
+	)
+	return i, err
+}
+
+const deleteScheduledChirp = `-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteScheduledChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteScheduledChirp(ctx context.Context, arg DeleteScheduledChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteScheduledChirp, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getScheduledChirps = `-- name: GetScheduledChirps :many
+SELECT id, user_id, body, publish_at, created_at, media_url FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) GetScheduledChirps(ctx context.Context, userID uuid.UUID) ([]ScheduledChirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ScheduledChirp
+	for rows.Next() {
+		var i ScheduledChirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Body,
+			&i.PublishAt,
+			&i.CreatedAt,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishDueScheduledChirps = `-- name: PublishDueScheduledChirps :execrows
+WITH due AS (
+    DELETE FROM scheduled_chirps
+    WHERE publish_at <= NOW()
+    RETURNING scheduled_chirps.id, scheduled_chirps.user_id, scheduled_chirps.body, scheduled_chirps.media_url
+)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, media_url, parent_id, root_id, depth)
+SELECT due.id, NOW(), NOW(), due.body, due.user_id, due.media_url, NULL, due.id, 0
+FROM due
+`
+
+// Moves the due chirps to chirps in one statement:
+// each is posted once, even with several instances running the job,
+// and stays scheduled if posting it fails.
+// A posted chirp keeps the id it had while scheduled.
+func (q *Queries) PublishDueScheduledChirps(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, publishDueScheduledChirps)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,91 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: search.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT
+    id, created_at, updated_at, body, user_id, media_url, edited_at, parent_id, root_id, depth, reply_count,
+    ts_rank_cd(search_vector, to_tsquery('english', $1))::real AS rank,
+    ts_headline(
+        'english',
+        replace(replace(replace(body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        to_tsquery('english', $1),
+        'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2'
+    )::text AS snippet
+FROM chirps
+WHERE search_vector @@ to_tsquery('english', $1)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $3 OFFSET $2
+`
+
+type SearchChirpsParams struct {
+	Query  string
+	Offset int32
+	Limit  int32
+}
+
+type SearchChirpsRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	MediaUrl   sql.NullString
+	EditedAt   sql.NullTime
+	ParentID   uuid.NullUUID
+	RootID     uuid.UUID
+	Depth      int32
+	ReplyCount int32
+	Rank       float32
+	Snippet    string
+}
+
+// Chirps matching the tsquery, best ranked first.
+// The snippet is HTML: the body is escaped and the matches are in <mark> tags.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps, arg.Query, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.MediaUrl,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.Depth,
+			&i.ReplyCount,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,230 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: subscriptions.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createSubscriptionEvent = `-- name: CreateSubscriptionEvent :one
+INSERT INTO subscription_events(id, user_id, event, source, webhook_event_id, status, current_period_end, payload, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, NOW())
+RETURNING id, user_id, event, source, webhook_event_id, status, current_period_end, payload, created_at
+`
+
+type CreateSubscriptionEventParams struct {
+	UserID           uuid.UUID
+	Event            string
+	Source           string
+	WebhookEventID   sql.NullString
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+	Payload          json.RawMessage
+}
+
+func (q *Queries) CreateSubscriptionEvent(ctx context.Context, arg CreateSubscriptionEventParams) (SubscriptionEvent, error) {
+	row := q.db.QueryRowContext(ctx, createSubscriptionEvent,
+		arg.UserID,
+		arg.Event,
+		arg.Source,
+		arg.WebhookEventID,
+		arg.Status,
+		arg.CurrentPeriodEnd,
+		arg.Payload,
+	)
+	var i SubscriptionEvent
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Event,
+		&i.Source,
+		&i.WebhookEventID,
+		&i.Status,
+		&i.CurrentPeriodEnd,
+		&i.Payload,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getExpiredSubscriptions = `-- name: GetExpiredSubscriptions :many
+SELECT user_id, plan, status, current_period_start, current_period_end, canceled_at, created_at, updated_at FROM subscriptions
+WHERE status IN ('active', 'past_due', 'canceled')
+AND current_period_end <= NOW()
+`
+
+// Subscriptions still granting perks whose period ended
+func (q *Queries) GetExpiredSubscriptions(ctx context.Context) ([]Subscription, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Subscription
+	for rows.Next() {
+		var i Subscription
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Plan,
+			&i.Status,
+			&i.CurrentPeriodStart,
+			&i.CurrentPeriodEnd,
+			&i.CanceledAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSubscription = `-- name: GetSubscription :one
+SELECT user_id, plan, status, current_period_start, current_period_end, canceled_at, created_at, updated_at FROM subscriptions
+WHERE user_id = $1
+`
+
+func (q *Queries) GetSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getSubscription, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.CanceledAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getSubscriptionEvents = `-- name: GetSubscriptionEvents :many
+SELECT id, user_id, event, source, webhook_event_id, status, current_period_end, payload, created_at FROM subscription_events
+WHERE $1::uuid IS NULL OR user_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetSubscriptionEventsParams struct {
+	UserID uuid.NullUUID
+	Limit  int32
+}
+
+// Newest first, optionally of a single user
+func (q *Queries) GetSubscriptionEvents(ctx context.Context, arg GetSubscriptionEventsParams) ([]SubscriptionEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getSubscriptionEvents, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SubscriptionEvent
+	for rows.Next() {
+		var i SubscriptionEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Event,
+			&i.Source,
+			&i.WebhookEventID,
+			&i.Status,
+			&i.CurrentPeriodEnd,
+			&i.Payload,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSubscriptionForUpdate = `-- name: GetSubscriptionForUpdate :one
+SELECT user_id, plan, status, current_period_start, current_period_end, canceled_at, created_at, updated_at FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE
+`
+
+// Locks the subscription until the end of the transaction
+func (q *Queries) GetSubscriptionForUpdate(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getSubscriptionForUpdate, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.CanceledAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertSubscription = `-- name: UpsertSubscription :one
+INSERT INTO subscriptions(user_id, plan, status, current_period_start, current_period_end, canceled_at, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    canceled_at = EXCLUDED.canceled_at,
+    updated_at = NOW()
+RETURNING user_id, plan, status, current_period_start, current_period_end, canceled_at, created_at, updated_at
+`
+
+type UpsertSubscriptionParams struct {
+	UserID             uuid.UUID
+	Plan               string
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   sql.NullTime
+	CanceledAt         sql.NullTime
+}
+
+func (q *Queries) UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, upsertSubscription,
+		arg.UserID,
+		arg.Plan,
+		arg.Status,
+		arg.CurrentPeriodStart,
+		arg.CurrentPeriodEnd,
+		arg.CanceledAt,
+	)
+	var i Subscription
+	err := row.Scan(
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.CanceledAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
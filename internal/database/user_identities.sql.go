@@ -0,0 +1,155 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: user_identities.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createOIDCLoginState = `-- name: CreateOIDCLoginState :one
+INSERT INTO oidc_login_states(state_hash, nonce, code_verifier, created_at, expires_at)
+VALUES (
+    $1, $2, $3,
+    NOW(), NOW() + INTERVAL '10 minutes'
+)
+RETURNING state_hash, nonce, code_verifier, created_at, expires_at
+`
+
+type CreateOIDCLoginStateParams struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+}
+
+func (q *Queries) CreateOIDCLoginState(ctx context.Context, arg CreateOIDCLoginStateParams) (OidcLoginState, error) {
+	row := q.db.QueryRowContext(ctx, createOIDCLoginState, arg.StateHash, arg.Nonce, arg.CodeVerifier)
+	var i OidcLoginState
+	err := row.Scan(
+		&i.StateHash,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const createUserIdentity = `-- name: CreateUserIdentity :one
+INSERT INTO user_identities(id, user_id, issuer, subject, email, created_at, last_login_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4,
+    NOW(), NOW()
+)
+RETURNING id, user_id, issuer, subject, email, created_at, last_login_at
+`
+
+type CreateUserIdentityParams struct {
+	UserID  uuid.UUID
+	Issuer  string
+	Subject string
+	Email   string
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRowContext(ctx, createUserIdentity,
+		arg.UserID,
+		arg.Issuer,
+		arg.Subject,
+		arg.Email,
+	)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Issuer,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+	return i, err
+}
+
+const getUserIdentities = `-- name: GetUserIdentities :many
+SELECT id, user_id, issuer, subject, email, created_at, last_login_at FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetUserIdentities(ctx context.Context, userID uuid.UUID) ([]UserIdentity, error) {
+	rows, err := q.db.QueryContext(ctx, getUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserIdentity
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Issuer,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+			&i.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const useOIDCLoginState = `-- name: UseOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+AND expires_at > NOW()
+RETURNING state_hash, nonce, code_verifier, created_at, expires_at
+`
+
+func (q *Queries) UseOIDCLoginState(ctx context.Context, stateHash string) (OidcLoginState, error) {
+	row := q.db.QueryRowContext(ctx, useOIDCLoginState, stateHash)
+	var i OidcLoginState
+	err := row.Scan(
+		&i.StateHash,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const useUserIdentity = `-- name: UseUserIdentity :one
+UPDATE user_identities
+SET last_login_at = NOW(), email = $3
+WHERE issuer = $1
+AND subject = $2
+RETURNING user_id
+`
+
+type UseUserIdentityParams struct {
+	Issuer  string
+	Subject string
+	Email   string
+}
+
+// Returns the user linked to the identity
+func (q *Queries) UseUserIdentity(ctx context.Context, arg UseUserIdentityParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, useUserIdentity, arg.Issuer, arg.Subject, arg.Email)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
@@ -0,0 +1,32 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.24.0
+// source: webhook_events.sql
+
+package database
+
+import (
+	"context"
+)
+
+const recordWebhookEvent = `-- name: RecordWebhookEvent :execrows
+INSERT INTO webhook_events(id, event, received_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (id) DO NOTHING
+`
+
+type RecordWebhookEventParams struct {
+	ID    string
+	Event string
+}
+
+// Returns 0 if the event was already recorded.
+// It's recorded in the transaction that handles it,
+// so an event that failed is handled again when Polka retries it.
+func (q *Queries) RecordWebhookEvent(ctx context.Context, arg RecordWebhookEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recordWebhookEvent, arg.ID, arg.Event)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,112 @@
+// Package entitlements holds what each plan allows its users to do
+// when they post chirps: how long chirps may be, whether they may be
+// edited or scheduled, and how many may be posted per hour.
+package entitlements
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Plans of Chirpy
+const (
+	PlanFree = "free"
+	// Chirpy Red, the same name as subscription.PlanRed
+	PlanRed = "red"
+)
+
+// Plan is what the users of a plan are allowed to do.
+type Plan struct {
+	// Characters allowed in a chirp
+	MaxChirpLength int
+	// Whether chirps can be edited after they are posted
+	CanEditChirps bool
+	// Whether chirps can be posted later, at a set time
+	CanScheduleChirps bool
+	// Chirps (posted or scheduled) allowed per hour
+	ChirpsPerHour int
+}
+
+// Plans are the plans by name.
+type Plans map[string]Plan
+
+// DefaultPlans is used for the settings that aren't configured.
+var DefaultPlans = Plans{
+	PlanFree: {
+		MaxChirpLength:    140,
+		CanEditChirps:     false,
+		CanScheduleChirps: false,
+		ChirpsPerHour:     30,
+	},
+	PlanRed: {
+		MaxChirpLength:    500,
+		CanEditChirps:     true,
+		CanScheduleChirps: true,
+		ChirpsPerHour:     300,
+	},
+}
+
+// Get returns the plan with the name.
+// Unknown plans get the free plan.
+func (p Plans) Get(name string) Plan {
+	if plan, ok := p[name]; ok {
+		return plan
+	}
+	return p[PlanFree]
+}
+
+// LoadPlans returns DefaultPlans with the settings found with getenv
+// (e.g. os.Getenv):
+// PLAN_<NAME>_MAX_CHIRP_LENGTH, PLAN_<NAME>_CAN_EDIT_CHIRPS,
+// PLAN_<NAME>_CAN_SCHEDULE_CHIRPS and PLAN_<NAME>_CHIRPS_PER_HOUR.
+func LoadPlans(getenv func(string) string) (Plans, error) {
+	plans := Plans{}
+	for name, plan := range DefaultPlans {
+		prefix := "PLAN_" + strings.ToUpper(name) + "_"
+		var err error
+
+		if v := getenv(prefix + "MAX_CHIRP_LENGTH"); v != "" {
+			plan.MaxChirpLength, err = parsePositive(prefix+"MAX_CHIRP_LENGTH", v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if v := getenv(prefix + "CAN_EDIT_CHIRPS"); v != "" {
+			plan.CanEditChirps, err = parseBool(prefix+"CAN_EDIT_CHIRPS", v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if v := getenv(prefix + "CAN_SCHEDULE_CHIRPS"); v != "" {
+			plan.CanScheduleChirps, err = parseBool(prefix+"CAN_SCHEDULE_CHIRPS", v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if v := getenv(prefix + "CHIRPS_PER_HOUR"); v != "" {
+			plan.ChirpsPerHour, err = parsePositive(prefix+"CHIRPS_PER_HOUR", v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		plans[name] = plan
+	}
+	return plans, nil
+}
+
+func parsePositive(key, v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive number", key, v)
+	}
+	return n, nil
+}
+
+func parseBool(key, v string) (bool, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: must be true or false", key, v)
+	}
+	return b, nil
+}
@@ -0,0 +1,84 @@
+package entitlements
+
+import (
+	"testing"
+)
+
+func TestLoadPlans(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Plans
+		wantErr bool
+	}{
+		{
+			name: "Defaults",
+			env:  map[string]string{},
+			want: DefaultPlans,
+		},
+		{
+			name: "Configured settings",
+			env: map[string]string{
+				"PLAN_RED_MAX_CHIRP_LENGTH":    "1000",
+				"PLAN_FREE_CAN_EDIT_CHIRPS":    "true",
+				"PLAN_RED_CAN_SCHEDULE_CHIRPS": "false",
+				"PLAN_FREE_CHIRPS_PER_HOUR":    "10",
+			},
+			want: Plans{
+				PlanFree: {
+					MaxChirpLength:    140,
+					CanEditChirps:     true,
+					CanScheduleChirps: false,
+					ChirpsPerHour:     10,
+				},
+				PlanRed: {
+					MaxChirpLength:    1000,
+					CanEditChirps:     true,
+					CanScheduleChirps: false,
+					ChirpsPerHour:     300,
+				},
+			},
+		},
+		{
+			name:    "Invalid length",
+			env:     map[string]string{"PLAN_RED_MAX_CHIRP_LENGTH": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid flag",
+			env:     map[string]string{"PLAN_RED_CAN_EDIT_CHIRPS": "sometimes"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid rate",
+			env:     map[string]string{"PLAN_FREE_CHIRPS_PER_HOUR": "many"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadPlans(func(key string) string { return tt.env[key] })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPlans() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("LoadPlans()[%s] = %+v, want %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlansGet(t *testing.T) {
+	if got := DefaultPlans.Get(PlanRed); got != DefaultPlans[PlanRed] {
+		t.Errorf("Get(%q) = %+v, want %+v", PlanRed, got, DefaultPlans[PlanRed])
+	}
+	if got := DefaultPlans.Get("platinum"); got != DefaultPlans[PlanFree] {
+		t.Errorf("Get() of an unknown plan = %+v, want the free plan", got)
+	}
+}
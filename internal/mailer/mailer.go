@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	From string
+	// Auth may be nil for servers that don't require authentication
+	Auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer sending through the SMTP server at addr,
+// authenticating with PLAIN auth if username is set.
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	m := &SMTPMailer{Addr: addr, From: from}
+	if username != "" {
+		host := strings.Split(addr, ":")[0]
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send sends the message.
+// net/smtp has no context support, so ctx is not used.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// Outbox keeps the messages instead of sending them,
+// for development and tests.
+// A file outbox also writes every message to a file in its directory.
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+	dir      string
+}
+
+// NewOutbox returns an in-memory outbox.
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+// NewFileOutbox returns an outbox writing messages as .eml files into dir.
+func NewFileOutbox(dir string) (*Outbox, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+// Send stores the message in the outbox.
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.dir != "" {
+		name := fmt.Sprintf("%s-%03d.eml", time.Now().UTC().Format("20060102T150405"), len(o.messages))
+		err := os.WriteFile(filepath.Join(o.dir, name), format("chirpy@localhost", msg), 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message{}, o.messages...)
+}
+
+// Last returns the last message sent to the address.
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func format(from string, msg Message) []byte {
+	return []byte(fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		from, msg.To, msg.Subject, msg.Body,
+	))
+}
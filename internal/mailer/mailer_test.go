@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutbox(t *testing.T) {
+	outbox := NewOutbox()
+	msgs := []Message{
+		{To: "a@example.com", Subject: "first", Body: "1"},
+		{To: "b@example.com", Subject: "second", Body: "2"},
+		{To: "a@example.com", Subject: "third", Body: "3"},
+	}
+	for _, msg := range msgs {
+		if err := outbox.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	if got := outbox.Messages(); len(got) != len(msgs) {
+		t.Errorf("Messages() returned %d messages, want %d", len(got), len(msgs))
+	}
+	last, ok := outbox.Last("a@example.com")
+	if !ok || last.Subject != "third" {
+		t.Errorf("Last() = %+v, %v, want the third message", last, ok)
+	}
+	if _, ok := outbox.Last("c@example.com"); ok {
+		t.Errorf("Last() found a message for an unknown address")
+	}
+}
+
+func TestFileOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatalf("NewFileOutbox() error = %v", err)
+	}
+	err = outbox.Send(context.Background(), Message{To: "a@example.com", Subject: "Hello", Body: "Hi there"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("outbox directory has %d files, want 1", len(entries))
+	}
+	dat, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: a@example.com", "Subject: Hello", "Hi there"} {
+		if !strings.Contains(string(dat), want) {
+			t.Errorf("message file doesn't contain %q:\n%s", want, dat)
+		}
+	}
+}
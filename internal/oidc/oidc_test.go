@@ -0,0 +1,339 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP is an in-process OpenID Connect provider.
+// It issues an authorization code for every authorization request
+// and ID tokens for the codes, signed with its current key.
+type fakeIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	clientID     string
+	clientSecret string
+
+	kid string
+	key *rsa.PrivateKey
+	// Keys published in the JWKS
+	published map[string]*rsa.PrivateKey
+
+	// Authorization requests by code
+	codes map[string]url.Values
+	// Claims of the next ID tokens
+	claims jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	idp := &fakeIdP{
+		t:            t,
+		clientID:     "chirpy",
+		clientSecret: "chirpy-secret",
+		published:    map[string]*rsa.PrivateKey{},
+		codes:        map[string]url.Values{},
+	}
+	idp.rotateKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		keys := []map[string]string{}
+		for kid, key := range idp.published {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("POST /token", idp.handleToken)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	idp.claims = jwt.MapClaims{
+		"sub":            "user-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+	return idp
+}
+
+func (idp *fakeIdP) rotateKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	idp.kid = kid
+	idp.key = key
+	idp.published[kid] = key
+}
+
+// authorize plays the user logging in at the provider:
+// it returns the code the provider would send to the callback.
+func (idp *fakeIdP) authorize(authCodeURL string) string {
+	u, err := url.Parse(authCodeURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	code := fmt.Sprintf("code-%d", len(idp.codes))
+	idp.codes[code] = u.Query()
+	return code
+}
+
+func (idp *fakeIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != idp.clientID || secret != idp.clientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	r.ParseForm()
+	authRequest, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok ||
+		authRequest.Get("redirect_uri") != r.PostForm.Get("redirect_uri") ||
+		authRequest.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   idp.clientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authRequest.Get("nonce"),
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idp.sign(claims),
+	})
+}
+
+func (idp *fakeIdP) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+func (idp *fakeIdP) discover(t *testing.T) *Provider {
+	t.Helper()
+	provider, err := Discover(context.Background(), idp.server.URL, Config{
+		ClientID:     idp.clientID,
+		ClientSecret: idp.clientSecret,
+		RedirectURL:  "http://chirpy.test/api/login/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	return provider
+}
+
+// The S256 challenge of the verifier used by the tests
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestDiscover(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.discover(t)
+	if provider.TokenEndpoint != idp.server.URL+"/token" {
+		t.Errorf("Discover() TokenEndpoint = %v, want %v", provider.TokenEndpoint, idp.server.URL+"/token")
+	}
+
+	// The document of another issuer is rejected
+	_, err := Discover(context.Background(), idp.server.URL+"/other", Config{})
+	if err == nil {
+		t.Errorf("Discover() of a wrong issuer error = nil")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.discover(t)
+
+	authCodeURL := provider.AuthCodeURL("state", "nonce", testChallenge)
+	if !strings.HasPrefix(authCodeURL, idp.server.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %v", authCodeURL)
+	}
+	code := idp.authorize(authCodeURL)
+
+	rawIDToken, err := provider.Exchange(context.Background(), code, testVerifier)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	idToken, err := provider.VerifyIDToken(context.Background(), rawIDToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	if idToken.Subject != "user-1" || idToken.Email != "user@example.com" || !idToken.EmailVerified {
+		t.Errorf("VerifyIDToken() = %+v", idToken)
+	}
+
+	// Codes are single-use
+	if _, err := provider.Exchange(context.Background(), code, testVerifier); err == nil {
+		t.Errorf("Exchange() of a used code error = nil")
+	}
+	// The code is bound to the PKCE verifier
+	code = idp.authorize(authCodeURL)
+	if _, err := provider.Exchange(context.Background(), code, strings.Repeat("a", 43)); err == nil {
+		t.Errorf("Exchange() with a wrong verifier error = nil")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.discover(t)
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.server.URL,
+			"aud":   idp.clientID,
+			"sub":   "user-1",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr bool
+	}{
+		{
+			name:    "Valid token",
+			token:   func() string { return idp.sign(validClaims()) },
+			wantErr: false,
+		},
+		{
+			name: "Wrong nonce",
+			token: func() string {
+				claims := validClaims()
+				claims["nonce"] = "other"
+				return idp.sign(claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "other-client"
+				return idp.sign(claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://evil.example.com"
+				return idp.sign(claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Expired",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return idp.sign(claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Signed with an unpublished key",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+				token.Header["kid"] = idp.kid
+				signed, _ := token.SignedString(otherKey)
+				return signed
+			},
+			wantErr: true,
+		},
+		{
+			name: "Signed with the client secret",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+				token.Header["kid"] = idp.kid
+				signed, _ := token.SignedString([]byte(idp.clientSecret))
+				return signed
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), tt.token(), "nonce")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.discover(t)
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   idp.clientID,
+		"sub":   "user-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce",
+	}
+
+	if _, err := provider.VerifyIDToken(context.Background(), idp.sign(claims), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+
+	// Tokens of a new key are verified once the JWKS is fetched again
+	idp.rotateKey("key-2")
+	provider.keysFetchedAt = time.Now().Add(-jwksRefreshInterval)
+	if _, err := provider.VerifyIDToken(context.Background(), idp.sign(claims), "nonce"); err != nil {
+		t.Errorf("VerifyIDToken() after key rotation error = %v", err)
+	}
+}
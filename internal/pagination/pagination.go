@@ -0,0 +1,141 @@
+// Package pagination implements keyset pagination with opaque cursors.
+// A cursor holds the sort key (created_at, id) of the row a page starts after,
+// and the direction to read in from there.
+// Listings without a unique sort key (ranked search results)
+// use offset cursors instead.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limits of the number of items of a page
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Offset cursors go this far at most
+const MaxOffset = 1000
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidLimit  = errors.New("invalid limit")
+)
+
+// Cursor points between two rows of a listing.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	// Whether the page is the one before the cursor (prev) instead of after (next)
+	Backward bool `json:"b,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor given to clients.
+func (c Cursor) Encode() string {
+	dat, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+// DecodeCursor parses a cursor returned by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	c := Cursor{}
+	err = json.Unmarshal(dat, &c)
+	if err != nil || c.CreatedAt.IsZero() || c.ID == uuid.Nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ParseLimit parses the limit query parameter:
+// DefaultLimit if it's empty, at most MaxLimit.
+func ParseLimit(s string) (int, error) {
+	if s == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, ErrInvalidLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	return limit, nil
+}
+
+// Page is the result of reading limit+1 rows from a cursor.
+type Page[T any] struct {
+	Items []T
+	// Cursors of the next and previous pages, nil on the first or last page
+	Next *Cursor
+	Prev *Cursor
+}
+
+// NewPage builds the page of rows read with the cursor (nil for the first page).
+// rows are the rows read in the cursor's direction, at most limit+1:
+// the extra row only tells there are more.
+// key returns the sort key of a row.
+func NewPage[T any](rows []T, limit int, cursor *Cursor, key func(T) (time.Time, uuid.UUID)) Page[T] {
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		// Read in reverse, back to the listing's order
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := Page[T]{Items: rows}
+	if len(rows) == 0 {
+		return page
+	}
+	firstAt, firstID := key(rows[0])
+	lastAt, lastID := key(rows[len(rows)-1])
+
+	// Reading forward, there are rows before if we started from a cursor,
+	// and after if the extra row was read. Backward it's the other way round.
+	if backward || more {
+		page.Next = &Cursor{CreatedAt: lastAt, ID: lastID}
+	}
+	if (backward && more) || (!backward && cursor != nil) {
+		page.Prev = &Cursor{CreatedAt: firstAt, ID: firstID, Backward: true}
+	}
+	return page
+}
+
+type offsetCursor struct {
+	Offset int `json:"o"`
+}
+
+// EncodeOffset returns the opaque cursor of the page starting at the offset.
+func EncodeOffset(offset int) string {
+	dat, _ := json.Marshal(offsetCursor{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+// DecodeOffset parses a cursor returned by EncodeOffset.
+func DecodeOffset(s string) (int, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	c := offsetCursor{}
+	err = json.Unmarshal(dat, &c)
+	if err != nil || c.Offset < 0 || c.Offset > MaxOffset {
+		return 0, ErrInvalidCursor
+	}
+	return c.Offset, nil
+}
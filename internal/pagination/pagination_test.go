@@ -0,0 +1,175 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type row struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func rowKey(r row) (time.Time, uuid.UUID) {
+	return r.CreatedAt, r.ID
+}
+
+func TestCursor(t *testing.T) {
+	want := Cursor{
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+		Backward:  true,
+	}
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID || got.Backward != want.Backward {
+		t.Errorf("DecodeCursor() = %+v, want %+v", got, want)
+	}
+
+	for _, s := range []string{"", "not a cursor!", "e30"} {
+		if _, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) error = %v, want %v", s, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestOffsetCursor(t *testing.T) {
+	for _, offset := range []int{0, 20, MaxOffset} {
+		got, err := DecodeOffset(EncodeOffset(offset))
+		if err != nil || got != offset {
+			t.Errorf("DecodeOffset() = %v, %v, want %v", got, err, offset)
+		}
+	}
+	for _, s := range []string{"not a cursor!", EncodeOffset(-1), EncodeOffset(MaxOffset + 1)} {
+		if _, err := DecodeOffset(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeOffset(%q) error = %v, want %v", s, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{input: "", want: DefaultLimit},
+		{input: "5", want: 5},
+		{input: "1000", want: MaxLimit},
+		{input: "0", wantErr: true},
+		{input: "-3", wantErr: true},
+		{input: "ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLimit(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rows := []row{}
+	for i := 0; i < 4; i++ {
+		rows = append(rows, row{CreatedAt: start.Add(time.Duration(i) * time.Minute), ID: uuid.New()})
+	}
+	cursor := &Cursor{CreatedAt: start, ID: uuid.New()}
+	backward := &Cursor{CreatedAt: start, ID: uuid.New(), Backward: true}
+
+	tests := []struct {
+		name      string
+		rows      []row
+		limit     int
+		cursor    *Cursor
+		wantItems []row
+		wantNext  *row
+		wantPrev  *row
+	}{
+		{
+			name:      "First page with more",
+			rows:      rows[:3],
+			limit:     2,
+			wantItems: rows[:2],
+			wantNext:  &rows[1],
+		},
+		{
+			name:      "Only page",
+			rows:      rows[:2],
+			limit:     2,
+			wantItems: rows[:2],
+		},
+		{
+			name:      "Forward from a cursor, last page",
+			rows:      rows[2:4],
+			limit:     2,
+			cursor:    cursor,
+			wantItems: rows[2:4],
+			wantPrev:  &rows[2],
+		},
+		{
+			name:      "Backward with more",
+			rows:      []row{rows[3], rows[2], rows[1]},
+			limit:     2,
+			cursor:    backward,
+			wantItems: rows[2:4],
+			wantNext:  &rows[3],
+			wantPrev:  &rows[2],
+		},
+		{
+			name:      "Backward to the first page",
+			rows:      []row{rows[1], rows[0]},
+			limit:     2,
+			cursor:    backward,
+			wantItems: rows[:2],
+			wantNext:  &rows[1],
+		},
+		{
+			name:   "Empty",
+			rows:   []row{},
+			limit:  2,
+			cursor: cursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]row{}, tt.rows...)
+			page := NewPage(input, tt.limit, tt.cursor, rowKey)
+			if len(page.Items) != len(tt.wantItems) {
+				t.Fatalf("NewPage() items = %v, want %v", page.Items, tt.wantItems)
+			}
+			for i := range page.Items {
+				if page.Items[i] != tt.wantItems[i] {
+					t.Errorf("NewPage() items[%d] = %v, want %v", i, page.Items[i], tt.wantItems[i])
+				}
+			}
+			checkCursor(t, "next", page.Next, tt.wantNext, false)
+			checkCursor(t, "prev", page.Prev, tt.wantPrev, true)
+		})
+	}
+}
+
+func checkCursor(t *testing.T, name string, got *Cursor, want *row, backward bool) {
+	t.Helper()
+	if want == nil {
+		if got != nil {
+			t.Errorf("NewPage() %s = %+v, want nil", name, got)
+		}
+		return
+	}
+	if got == nil || got.ID != want.ID || !got.CreatedAt.Equal(want.CreatedAt) || got.Backward != backward {
+		t.Errorf("NewPage() %s = %+v, want %+v", name, got, want)
+	}
+}
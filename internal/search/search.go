@@ -0,0 +1,128 @@
+// Package search turns the text users search chirps with
+// into a Postgres tsquery.
+//
+// The syntax is:
+//   - words: chirps with all of them (with the same stem)
+//   - "several words": the words next to each other, in this order
+//   - word*: words starting with it
+//   - -word, -"several words": chirps without it
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Limits of a query
+const (
+	MaxQueryLength = 200
+	MaxTerms       = 16
+)
+
+var (
+	ErrEmptyQuery     = errors.New("query has no words")
+	ErrOnlyNegated    = errors.New("query needs a word that isn't negated")
+	ErrQueryTooLong   = errors.New("query is too long")
+	ErrUnclosedPhrase = errors.New("query has an unclosed quote")
+)
+
+// term is a word, a prefix or a phrase of the query
+type term struct {
+	words   []string
+	prefix  bool
+	negated bool
+}
+
+// ParseQuery returns the tsquery (for to_tsquery) of a search.
+// Only letters and digits of the search end up in the tsquery.
+func ParseQuery(q string) (string, error) {
+	if len(q) > MaxQueryLength {
+		return "", ErrQueryTooLong
+	}
+
+	terms := []term{}
+	rest := strings.TrimSpace(q)
+	for rest != "" {
+		t := term{}
+		if rest[0] == '-' {
+			t.negated = true
+			rest = rest[1:]
+		}
+
+		var text string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return "", ErrUnclosedPhrase
+			}
+			text = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			text = rest[:end]
+			rest = rest[end:]
+			if strings.HasSuffix(text, "*") {
+				t.prefix = true
+				text = strings.TrimRight(text, "*")
+			}
+		}
+		rest = strings.TrimSpace(rest)
+
+		t.words = words(text)
+		if len(t.words) == 0 {
+			continue
+		}
+		terms = append(terms, t)
+	}
+
+	if len(terms) == 0 {
+		return "", ErrEmptyQuery
+	}
+	if len(terms) > MaxTerms {
+		return "", ErrQueryTooLong
+	}
+
+	parts := []string{}
+	positive := false
+	for _, t := range terms {
+		positive = positive || !t.negated
+		parts = append(parts, t.tsquery())
+	}
+	// A query of negations only would match nearly every chirp
+	if !positive {
+		return "", ErrOnlyNegated
+	}
+	return strings.Join(parts, " & "), nil
+}
+
+func (t term) tsquery() string {
+	lexemes := []string{}
+	for i, word := range t.words {
+		lexeme := "'" + word + "'"
+		// The prefix applies to the last word ("e-mai*" is "e" then a prefix "mai")
+		if t.prefix && i == len(t.words)-1 {
+			lexeme += ":*"
+		}
+		lexemes = append(lexemes, lexeme)
+	}
+
+	s := strings.Join(lexemes, " <-> ")
+	if len(lexemes) > 1 {
+		s = "(" + s + ")"
+	}
+	if t.negated {
+		s = "!" + s
+	}
+	return s
+}
+
+// words splits the text into its words of letters and digits, lower case
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
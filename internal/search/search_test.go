@@ -0,0 +1,84 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Words",
+			query: "Hello  World",
+			want:  "'hello' & 'world'",
+		},
+		{
+			name:  "Phrase",
+			query: `"good morning" chirpy`,
+			want:  "('good' <-> 'morning') & 'chirpy'",
+		},
+		{
+			name:  "Prefix",
+			query: "chirp*",
+			want:  "'chirp':*",
+		},
+		{
+			name:  "Negation",
+			query: `coffee -tea -"green tea"`,
+			want:  "'coffee' & !'tea' & !('green' <-> 'tea')",
+		},
+		{
+			name:  "Punctuation is dropped",
+			query: "it's e-mail!",
+			want:  "('it' <-> 's') & ('e' <-> 'mail')",
+		},
+		{
+			name:  "Operators can't be injected",
+			query: "a|b & !c ') :*",
+			want:  "('a' <-> 'b') & 'c'",
+		},
+		{
+			name:    "Empty",
+			query:   " ?! ",
+			wantErr: ErrEmptyQuery,
+		},
+		{
+			name:    "Negations only",
+			query:   "-tea",
+			wantErr: ErrOnlyNegated,
+		},
+		{
+			name:    "Unclosed quote",
+			query:   `"good morning`,
+			wantErr: ErrUnclosedPhrase,
+		},
+		{
+			name:    "Too many terms",
+			query:   strings.Repeat("a ", MaxTerms+1),
+			wantErr: ErrQueryTooLong,
+		},
+		{
+			name:    "Too long",
+			query:   strings.Repeat("a", MaxQueryLength+1),
+			wantErr: ErrQueryTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuery(tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseQuery() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Package subscription holds the lifecycle of Chirpy Red subscriptions:
+// how each billing event changes a subscription
+// and whether a subscription grants its plan's perks.
+package subscription
+
+import (
+	"errors"
+	"time"
+)
+
+// Status of a subscription
+type Status string
+
+const (
+	// Paid for the current period
+	StatusActive Status = "active"
+	// The last payment failed, the perks last until the period ends
+	StatusPastDue Status = "past_due"
+	// Won't be renewed, the perks last until the period ends
+	StatusCanceled Status = "canceled"
+	// Ended, no perks
+	StatusExpired Status = "expired"
+	// Paid back, no perks
+	StatusRefunded Status = "refunded"
+)
+
+// PlanRed is the plan sold through Polka
+const PlanRed = "red"
+
+// Events sent by Polka, and the one sent by the expiry job
+const (
+	EventUpgraded      = "user.upgraded"
+	EventRenewed       = "user.renewed"
+	EventDowngraded    = "user.downgraded"
+	EventCancelled     = "user.cancelled"
+	EventRefunded      = "user.refunded"
+	EventPaymentFailed = "user.payment_failed"
+	EventExpired       = "subscription.expired"
+)
+
+// ErrUnknownEvent is returned by Apply for events it doesn't handle
+var ErrUnknownEvent = errors.New("unknown subscription event")
+
+// Subscription is the state of a user's subscription.
+// The zero value is "never subscribed".
+type Subscription struct {
+	Plan        string
+	Status      Status
+	PeriodStart time.Time
+	// Zero for a subscription without an end
+	// (the Chirpy Red members from before subscriptions were tracked)
+	PeriodEnd  time.Time
+	CanceledAt time.Time
+}
+
+// Apply returns the subscription after the event, received at now.
+// periodEnd is the end of the period sent with the event (zero if none).
+func Apply(sub Subscription, event string, periodEnd, now time.Time) (Subscription, error) {
+	if sub.Plan == "" {
+		sub.Plan = PlanRed
+	}
+
+	switch event {
+	case EventUpgraded:
+		sub.Status = StatusActive
+		sub.PeriodStart = now
+		sub.PeriodEnd = periodEnd
+		sub.CanceledAt = time.Time{}
+
+	case EventRenewed:
+		// The new period starts when the current one ends
+		// (or now, if it already ended)
+		start := now
+		if sub.Entitled(now) && !sub.PeriodEnd.IsZero() {
+			start = sub.PeriodEnd
+		}
+		if periodEnd.IsZero() {
+			periodEnd = start.AddDate(0, 1, 0)
+		}
+		sub.Status = StatusActive
+		sub.PeriodStart = start
+		sub.PeriodEnd = periodEnd
+		sub.CanceledAt = time.Time{}
+
+	case EventPaymentFailed:
+		if sub.Status == StatusActive {
+			sub.Status = StatusPastDue
+		}
+
+	case EventCancelled:
+		sub.CanceledAt = now
+		sub.Status = StatusCanceled
+		// Without a period there is nothing left to use
+		if sub.PeriodEnd.IsZero() || !now.Before(sub.PeriodEnd) {
+			sub = sub.end(StatusExpired, now)
+		}
+
+	case EventDowngraded, EventExpired:
+		sub = sub.end(StatusExpired, now)
+
+	case EventRefunded:
+		sub = sub.end(StatusRefunded, now)
+
+	default:
+		return sub, ErrUnknownEvent
+	}
+	return sub, nil
+}
+
+// end ends the subscription now, unless its period already ended.
+func (s Subscription) end(status Status, now time.Time) Subscription {
+	s.Status = status
+	if s.PeriodEnd.IsZero() || s.PeriodEnd.After(now) {
+		s.PeriodEnd = now
+	}
+	return s
+}
+
+// Entitled reports whether the subscription grants its plan's perks at now.
+func (s Subscription) Entitled(now time.Time) bool {
+	switch s.Status {
+	case StatusActive, StatusPastDue, StatusCanceled:
+		return s.PeriodEnd.IsZero() || now.Before(s.PeriodEnd)
+	default:
+		return false
+	}
+}
+
+// Lapsed reports whether the subscription still has the status of a
+// subscription with perks although its period ended at now:
+// it's waiting for EventExpired.
+func (s Subscription) Lapsed(now time.Time) bool {
+	switch s.Status {
+	case StatusActive, StatusPastDue, StatusCanceled:
+		return !s.PeriodEnd.IsZero() && !now.Before(s.PeriodEnd)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,168 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	monthEnd := now.AddDate(0, 1, 0)
+	active := Subscription{
+		Plan:        PlanRed,
+		Status:      StatusActive,
+		PeriodStart: now.AddDate(0, 0, -10),
+		PeriodEnd:   now.AddDate(0, 0, 20),
+	}
+	lapsed := active
+	lapsed.PeriodEnd = now.AddDate(0, 0, -1)
+
+	tests := []struct {
+		name         string
+		sub          Subscription
+		event        string
+		periodEnd    time.Time
+		wantStatus   Status
+		wantEnd      time.Time
+		wantEntitled bool
+	}{
+		{
+			name:         "Upgrade",
+			sub:          Subscription{},
+			event:        EventUpgraded,
+			periodEnd:    monthEnd,
+			wantStatus:   StatusActive,
+			wantEnd:      monthEnd,
+			wantEntitled: true,
+		},
+		{
+			name:         "Upgrade without period",
+			sub:          Subscription{},
+			event:        EventUpgraded,
+			wantStatus:   StatusActive,
+			wantEnd:      time.Time{},
+			wantEntitled: true,
+		},
+		{
+			name:         "Renewal extends the current period",
+			sub:          active,
+			event:        EventRenewed,
+			wantStatus:   StatusActive,
+			wantEnd:      active.PeriodEnd.AddDate(0, 1, 0),
+			wantEntitled: true,
+		},
+		{
+			name:         "Renewal after the period ended",
+			sub:          lapsed,
+			event:        EventRenewed,
+			wantStatus:   StatusActive,
+			wantEnd:      monthEnd,
+			wantEntitled: true,
+		},
+		{
+			name:         "Payment failed keeps the perks until the period ends",
+			sub:          active,
+			event:        EventPaymentFailed,
+			wantStatus:   StatusPastDue,
+			wantEnd:      active.PeriodEnd,
+			wantEntitled: true,
+		},
+		{
+			name:         "Cancellation keeps the perks until the period ends",
+			sub:          active,
+			event:        EventCancelled,
+			wantStatus:   StatusCanceled,
+			wantEnd:      active.PeriodEnd,
+			wantEntitled: true,
+		},
+		{
+			name:         "Cancellation without period",
+			sub:          Subscription{Plan: PlanRed, Status: StatusActive},
+			event:        EventCancelled,
+			wantStatus:   StatusExpired,
+			wantEnd:      now,
+			wantEntitled: false,
+		},
+		{
+			name:         "Downgrade",
+			sub:          active,
+			event:        EventDowngraded,
+			wantStatus:   StatusExpired,
+			wantEnd:      now,
+			wantEntitled: false,
+		},
+		{
+			name:         "Refund",
+			sub:          active,
+			event:        EventRefunded,
+			wantStatus:   StatusRefunded,
+			wantEnd:      now,
+			wantEntitled: false,
+		},
+		{
+			name:         "Expiry keeps the period end",
+			sub:          lapsed,
+			event:        EventExpired,
+			wantStatus:   StatusExpired,
+			wantEnd:      lapsed.PeriodEnd,
+			wantEntitled: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.sub, tt.event, tt.periodEnd, now)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("Apply() status = %v, want %v", got.Status, tt.wantStatus)
+			}
+			if !got.PeriodEnd.Equal(tt.wantEnd) {
+				t.Errorf("Apply() period end = %v, want %v", got.PeriodEnd, tt.wantEnd)
+			}
+			if got.Entitled(now) != tt.wantEntitled {
+				t.Errorf("Entitled() = %v, want %v", got.Entitled(now), tt.wantEntitled)
+			}
+		})
+	}
+
+	if _, err := Apply(active, "user.unknown", time.Time{}, now); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("Apply() of an unknown event error = %v, want %v", err, ErrUnknownEvent)
+	}
+}
+
+func TestEntitledAfterPeriodEnd(t *testing.T) {
+	now := time.Now()
+	sub := Subscription{Plan: PlanRed, Status: StatusCanceled, PeriodEnd: now}
+	if sub.Entitled(now) {
+		t.Errorf("Entitled() at the period end = true")
+	}
+	if !sub.Entitled(now.Add(-time.Second)) {
+		t.Errorf("Entitled() before the period end = false")
+	}
+}
+
+func TestLapsed(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		sub  Subscription
+		want bool
+	}{
+		{name: "Period ended", sub: Subscription{Status: StatusActive, PeriodEnd: now.Add(-time.Minute)}, want: true},
+		{name: "Canceled, period ended", sub: Subscription{Status: StatusCanceled, PeriodEnd: now}, want: true},
+		{name: "Renewed", sub: Subscription{Status: StatusActive, PeriodEnd: now.AddDate(0, 1, 0)}, want: false},
+		{name: "Without an end", sub: Subscription{Status: StatusActive}, want: false},
+		{name: "Already expired", sub: Subscription{Status: StatusExpired, PeriodEnd: now.Add(-time.Minute)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.Lapsed(now); got != tt.want {
+				t.Errorf("Lapsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
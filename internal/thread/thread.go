@@ -0,0 +1,37 @@
+// Package thread arranges the chirps of a conversation into a tree.
+package thread
+
+import (
+	"github.com/google/uuid"
+)
+
+// Node is an item of the tree and the replies to it.
+type Node[T any] struct {
+	Item    T
+	Replies []*Node[T]
+}
+
+// Build arranges the items (ordered with parents before their replies,
+// e.g. by creation time) into trees.
+// Items whose parent isn't among them (a deleted parent,
+// or one on another page) are roots of the returned trees.
+// id returns the id of an item, parentID the id of its parent.
+func Build[T any](items []T, id func(T) uuid.UUID, parentID func(T) uuid.NullUUID) []*Node[T] {
+	roots := []*Node[T]{}
+	nodes := make(map[uuid.UUID]*Node[T], len(items))
+	for _, item := range items {
+		node := &Node[T]{Item: item, Replies: []*Node[T]{}}
+		nodes[id(item)] = node
+
+		var parent *Node[T]
+		if p := parentID(item); p.Valid {
+			parent = nodes[p.UUID]
+		}
+		if parent != nil {
+			parent.Replies = append(parent.Replies, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,59 @@
+package thread
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type chirp struct {
+	ID       uuid.UUID
+	ParentID uuid.NullUUID
+}
+
+func reply(parent chirp) chirp {
+	return chirp{ID: uuid.New(), ParentID: uuid.NullUUID{UUID: parent.ID, Valid: true}}
+}
+
+func TestBuild(t *testing.T) {
+	root := chirp{ID: uuid.New()}
+	a := reply(root)
+	b := reply(root)
+	a1 := reply(a)
+	a1x := reply(a1)
+	// Its parent was deleted (or is on another page)
+	orphan := reply(chirp{ID: uuid.New()})
+
+	trees := Build([]chirp{a, b, a1, orphan, a1x}, func(c chirp) uuid.UUID {
+		return c.ID
+	}, func(c chirp) uuid.NullUUID {
+		return c.ParentID
+	})
+
+	tests := []struct {
+		name        string
+		node        *Node[chirp]
+		want        chirp
+		wantReplies int
+	}{
+		{name: "First reply", node: trees[0], want: a, wantReplies: 1},
+		{name: "Second reply", node: trees[1], want: b, wantReplies: 0},
+		{name: "Orphan", node: trees[2], want: orphan, wantReplies: 0},
+		{name: "Reply to a reply", node: trees[0].Replies[0], want: a1, wantReplies: 1},
+		{name: "Deepest reply", node: trees[0].Replies[0].Replies[0], want: a1x, wantReplies: 0},
+	}
+
+	if len(trees) != 3 {
+		t.Fatalf("Build() = %d trees, want 3", len(trees))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.node.Item != tt.want {
+				t.Errorf("Build() item = %v, want %v", tt.node.Item, tt.want)
+			}
+			if len(tt.node.Replies) != tt.wantReplies {
+				t.Errorf("Build() replies = %d, want %d", len(tt.node.Replies), tt.wantReplies)
+			}
+		})
+	}
+}
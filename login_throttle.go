@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+)
+
+// Failed logins are tracked per account and per client IP.
+// An IP gets more attempts, as many users can share it.
+var (
+	accountLockoutPolicy = auth.LockoutPolicy{
+		Threshold: 5,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  time.Hour,
+	}
+	ipLockoutPolicy = auth.LockoutPolicy{
+		Threshold: 20,
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  time.Hour,
+	}
+)
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginThrottle is a throttle key with its lockout policy.
+type loginThrottle struct {
+	Key    string
+	Policy auth.LockoutPolicy
+}
+
+// loginThrottles returns the throttles of a login (account first, then IP:
+// the rows are always locked in this order).
+func loginThrottles(accountKey, ipKey string) []loginThrottle {
+	return []loginThrottle{
+		{Key: accountKey, Policy: accountLockoutPolicy},
+		{Key: ipKey, Policy: ipLockoutPolicy},
+	}
+}
+
+// errLoginLocked rolls back the attempts counted by takeLoginAttempt
+var errLoginLocked = errors.New("login is locked")
+
+// takeLoginAttempt counts a login attempt for every throttle
+// before the credentials are checked, and returns until when logins are
+// locked for any of them (zero time if they aren't, then the attempt may go on).
+// Counting and checking happen with the throttles locked,
+// so parallel attempts can't all get past the threshold:
+// the attempt that reaches it locks the throttle right away.
+// Attempts that turn out right are uncounted with forgiveLoginAttempt.
+func (cfg *apiConfig) takeLoginAttempt(ctx context.Context, throttles ...loginThrottle) (time.Time, error) {
+	lockedUntil := time.Time{}
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		now := time.Now()
+		attempts := make([]database.LoginThrottle, len(throttles))
+		for i, throttle := range throttles {
+			attempt, err := q.TakeLoginAttempt(ctx, throttle.Key)
+			if err != nil {
+				return err
+			}
+			if attempt.LockedUntil.Valid && attempt.LockedUntil.Time.After(lockedUntil) {
+				lockedUntil = attempt.LockedUntil.Time
+			}
+			attempts[i] = attempt
+		}
+		if lockedUntil.After(now) {
+			// Nothing is counted while locked
+			return errLoginLocked
+		}
+
+		for i, throttle := range throttles {
+			lockout := throttle.Policy.Lockout(int(attempts[i].FailedAttempts))
+			if lockout == 0 {
+				continue
+			}
+			err := q.LockLogin(ctx, database.LockLoginParams{
+				Key:         throttle.Key,
+				LockedUntil: sql.NullTime{Time: now.Add(lockout), Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errLoginLocked) {
+		return lockedUntil, nil
+	}
+	return time.Time{}, err
+}
+
+// forgiveLoginAttempt uncounts the attempt taken by takeLoginAttempt
+// for every throttle, once the credentials are known to be right.
+func (cfg *apiConfig) forgiveLoginAttempt(ctx context.Context, throttles ...loginThrottle) error {
+	for _, throttle := range throttles {
+		err := cfg.DB.ForgiveLoginAttempt(ctx, database.ForgiveLoginAttemptParams{
+			Key:       throttle.Key,
+			Threshold: int32(throttle.Policy.Threshold),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetLoginAttempts ends a successful login:
+// the account's failed attempts are reset,
+// the client's attempt is uncounted (other users may share its IP).
+func (cfg *apiConfig) resetLoginAttempts(ctx context.Context, accountKey, ipKey string) error {
+	err := cfg.DB.ResetLoginThrottle(ctx, accountKey)
+	if err != nil {
+		return err
+	}
+	return cfg.forgiveLoginAttempt(ctx, loginThrottle{Key: ipKey, Policy: ipLockoutPolicy})
+}
+
+// respondWithLockout responds with a 429 status code
+// telling the client when to try again.
+func respondWithLockout(w http.ResponseWriter, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+}
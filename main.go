@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/Bayan2019/go-http-server/internal/auth"
 	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/entitlements"
+	"github.com/Bayan2019/go-http-server/internal/mailer"
+	"github.com/Bayan2019/go-http-server/internal/oidc"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -18,10 +27,35 @@ import (
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	DB             *database.Queries
-	Platform       string
-	jwtSecret      string
+	// The connection of DB, to run queries in transactions (see withTx)
+	conn *sql.DB
+	// Keys that sign and verify access tokens
+	jwtKeys *auth.KeySet
+	// Access tokens revoked before they expire (see revocation.go)
+	denylist *auth.Denylist
+	// Key of the HMAC used to store refresh tokens hashed
+	refreshTokenKey string
 	// Load POLKA_KEY into your server and store it in your apiConfig
-	polkaKey string
+	// Secrets that sign Polka webhooks (several during a rotation)
+	polkaKeys []string
+	// Sends emails (password resets)
+	mailer mailer.Mailer
+	// Public URL of the server, used in links sent by email
+	baseURL string
+	// Only users with a verified email may post chirps
+	requireVerifiedEmail bool
+	// argon2id parameters of new password hashes
+	passwordParams auth.Argon2Params
+	// Rules for new passwords
+	passwordPolicy auth.PasswordPolicy
+	// Consent page of the OAuth authorization endpoint
+	consentTemplate *template.Template
+	// External OpenID Connect provider users can log in with (optional)
+	oidcProvider *oidc.Provider
+	// What the users of each plan may do with chirps
+	plans entitlements.Plans
+	// How long after they are posted chirps can be edited
+	chirpEditWindow time.Duration
 }
 
 func main() {
@@ -42,10 +76,6 @@ func main() {
 	if dbURL == "" {
 		log.Fatal("DB_URL is not found in the environment")
 	}
-	platform := os.Getenv("PLATFORM")
-	if platform == "" {
-		log.Fatal("PLATFORM must be set")
-	}
 
 	// Use a standard http.FileServer as the handler
 	// Use http.Dir to convert a filepath
@@ -66,29 +96,186 @@ func main() {
 	// By keeping it safe, no other servers will be able
 	// to create valid JWTs for your server.
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	// JWT_KEYS_DIR is a directory of RS256/EdDSA/HS256 keys
+	// (see auth.LoadKeySet) that replaces the single JWT_SECRET.
+	jwtKeysDir := os.Getenv("JWT_KEYS_DIR")
+	if jwtSecret == "" && jwtKeysDir == "" {
+		log.Fatal("JWT_SECRET or JWT_KEYS_DIR environment variable must be set")
+	}
+	jwtKeys := auth.NewHMACKeySet(jwtSecret)
+	if jwtKeysDir != "" {
+		jwtKeys, err = auth.LoadKeySet(jwtKeysDir)
+		if err != nil {
+			log.Fatalf("Error loading JWT keys: %s", err)
+		}
+		if jwtSecret != "" {
+			// Keep accepting the tokens signed with JWT_SECRET
+			// until they expire.
+			jwtKeys.AddKey(auth.NewHMACKey("", jwtSecret))
+		}
+	}
+
+	// This is the key used to hash refresh tokens before they are stored,
+	// so the database never holds a usable refresh token.
+	refreshTokenKey := os.Getenv("REFRESH_TOKEN_KEY")
+	if refreshTokenKey == "" {
+		log.Fatal("REFRESH_TOKEN_KEY environment variable is not set")
 	}
 
 	// Add a new secret value to your .env file called POLKA_KEY.
-	// This is the api key that polka will send so that
+	// This is the secret polka signs its webhooks with so that
 	// we know it's them (and not someone else trying to get free Chirpy red).
+	// While it's rotated, POLKA_KEY holds the old and the new secrets, comma-separated.
 	// Load it into your server and store it in your apiConfig.
-	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
+	polkaKeys := []string{}
+	for _, key := range strings.Split(os.Getenv("POLKA_KEY"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			polkaKeys = append(polkaKeys, key)
+		}
+	}
+	if len(polkaKeys) == 0 {
 		log.Fatal("POLKA_KEY environment variable is not set")
 	}
 
+	// Emails are sent through SMTP_ADDR if it's set.
+	// Otherwise they are written to OUTBOX_DIR (or only kept in memory)
+	// for development.
+	var appMailer mailer.Mailer
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		appMailer = mailer.NewSMTPMailer(
+			smtpAddr,
+			os.Getenv("MAIL_FROM"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+		)
+	} else if outboxDir := os.Getenv("OUTBOX_DIR"); outboxDir != "" {
+		appMailer, err = mailer.NewFileOutbox(outboxDir)
+		if err != nil {
+			log.Fatalf("Error creating outbox: %s", err)
+		}
+	} else {
+		log.Printf("Warning: SMTP_ADDR and OUTBOX_DIR are not set, emails are only kept in memory and never sent")
+		appMailer = mailer.NewOutbox()
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+
+	// REQUIRE_VERIFIED_EMAIL=true blocks chirp creation for unverified accounts
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+
+	// The argon2id cost can be tuned with ARGON2_MEMORY_KIB, ARGON2_TIME and ARGON2_THREADS.
+	// Stored hashes are upgraded to the current parameters at login.
+	passwordParams := auth.DefaultArgon2Params
+	if v := os.Getenv("ARGON2_MEMORY_KIB"); v != "" {
+		memory, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid ARGON2_MEMORY_KIB: %s", err)
+		}
+		passwordParams.Memory = uint32(memory)
+	}
+	if v := os.Getenv("ARGON2_TIME"); v != "" {
+		iterations, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid ARGON2_TIME: %s", err)
+		}
+		passwordParams.Time = uint32(iterations)
+	}
+	if v := os.Getenv("ARGON2_THREADS"); v != "" {
+		threads, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			log.Fatalf("Invalid ARGON2_THREADS: %s", err)
+		}
+		passwordParams.Threads = uint8(threads)
+	}
+	err = passwordParams.Validate()
+	if err != nil {
+		log.Fatalf("Invalid argon2 parameters: %s", err)
+	}
+
+	// New passwords must have PASSWORD_MIN_LENGTH characters
+	// of PASSWORD_MIN_CHARACTER_CLASSES classes,
+	// and must not be in the breached password list in BREACHED_PASSWORDS_DIR.
+	passwordPolicy := auth.DefaultPasswordPolicy
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		passwordPolicy.MinLength, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %s", err)
+		}
+	}
+	if v := os.Getenv("PASSWORD_MIN_CHARACTER_CLASSES"); v != "" {
+		passwordPolicy.MinCharacterClasses, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_CHARACTER_CLASSES: %s", err)
+		}
+	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		passwordPolicy.Breached, err = auth.LoadBreachedPasswords(dir)
+		if err != nil {
+			log.Fatalf("Error loading breached passwords: %s", err)
+		}
+	}
+
+	// The OAuth consent page (templates/consent.html)
+	consentTemplate, err := template.New("consent.html").Parse(consentPageTemplate)
+	if err != nil {
+		log.Fatalf("Error loading consent page: %s", err)
+	}
+
+	// Users can log in with the OpenID Connect provider OIDC_ISSUER
+	// where Chirpy is registered as OIDC_CLIENT_ID
+	var oidcProvider *oidc.Provider
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		oidcProvider, err = oidc.Discover(context.Background(), issuer, oidc.Config{
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/login/oidc/callback",
+		})
+		if err != nil {
+			log.Fatalf("Error loading OIDC provider: %s", err)
+		}
+	}
+
+	// The perks of each plan can be changed with PLAN_<NAME>_* variables
+	// (e.g. PLAN_RED_MAX_CHIRP_LENGTH).
+	plans, err := entitlements.LoadPlans(os.Getenv)
+	if err != nil {
+		log.Fatalf("Error loading plans: %s", err)
+	}
+
+	// Chirps can be edited for CHIRP_EDIT_WINDOW (e.g. "30m") after they are posted
+	chirpEditWindow := time.Hour
+	if v := os.Getenv("CHIRP_EDIT_WINDOW"); v != "" {
+		chirpEditWindow, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid CHIRP_EDIT_WINDOW: %s", err)
+		}
+	}
+
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		// and store db in your apiConfig struct so
 		// that handlers can access it:
-		DB:       db,
-		Platform: platform,
-		// store JWT Secret in your apiConfig struct.
-		jwtSecret: jwtSecret,
+		DB:   db,
+		conn: conn,
+		// store JWT keys in your apiConfig struct.
+		jwtKeys:         jwtKeys,
+		denylist:        auth.NewDenylist(),
+		refreshTokenKey: refreshTokenKey,
 		// Load POLKA_KEY into your server and store it in your apiConfig.
-		polkaKey: polkaKey,
+		polkaKeys: polkaKeys,
+		mailer:    appMailer,
+		baseURL:   baseURL,
+
+		requireVerifiedEmail: requireVerifiedEmail,
+		passwordParams:       passwordParams,
+		passwordPolicy:       passwordPolicy,
+		consentTemplate:      consentTemplate,
+		oidcProvider:         oidcProvider,
+		plans:                plans,
+		chirpEditWindow:      chirpEditWindow,
 	}
 
 	// Create a new http.ServeMux
@@ -114,13 +301,22 @@ func main() {
 	// we'll be serving the API from the /api path
 	// Swap out the GET /api/metrics endpoint,
 	// which just returns plain text, for a GET /admin/metrics
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	// The /admin/* routes are only allowed for users with the admin role.
+	mux.Handle("GET /admin/metrics", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerMetrics)))
 	// create and register a handler on the /reset path
 	// that, when hit, will reset your fileserverHits back to 0
 	// Update the /reset endpoint to only accept POST requests
 	// we'll be serving the API from the /api path
 	// pdate the POST /api/reset to POST /admin/reset.
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.Handle("POST /admin/reset", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerReset)))
+	// Moderation endpoints
+	mux.Handle("GET /admin/users", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminGetUsers)))
+	mux.Handle("PUT /admin/users/{userID}/roles", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminUpdateUserRoles)))
+	mux.Handle("POST /admin/users/{userID}/unlock", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminUnlockUser)))
+	mux.Handle("DELETE /admin/chirps/{chirpID}", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminDeleteChirp)))
+	// Ledger of the Chirpy Red subscription events
+	mux.Handle("GET /admin/subscription-events", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminGetSubscriptionEvents)))
+	mux.Handle("GET /admin/users/{userID}/subscription", apiCfg.requireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminGetUserSubscription)))
 	// Add a new endpoint to the Chirpy API that accepts a POST request at /api/validate_chirp
 	// Delete the /api/validate_chirp endpoint that we created before
 	// but port all that logic into POST /api/chirps.
@@ -130,27 +326,89 @@ func main() {
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
 	// Add a POST /api/chirps handler.
 	// It accepts a JSON payload with a body field:
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
+	// Routes that require a logged in user are wrapped with middlewareAuth,
+	// which puts the authenticated user into the request context.
+	// Routes wrapped with requireScope accept personal access tokens
+	// with the scope too.
+	mux.Handle("POST /api/chirps", apiCfg.requireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiCfg.handlerCreateChirp)))
 	// Add a GET /api/chirps endpoint that returns all chirps in the database.
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
 	// Add a GET /api/chirps/{chirpID} endpoint
 	// that returns a single chirp by its ID.
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
+	// Anyone can read it, a token sent along must still be valid.
+	mux.Handle("GET /api/chirps/{chirpID}", apiCfg.middlewareOptionalAuth(http.HandlerFunc(apiCfg.handlerGetChirp)))
+	// Full-text search over the chirps
+	mux.HandleFunc("GET /api/search/chirps", apiCfg.handlerSearchChirps)
+	// Chirpy Red perks: editing chirps and posting them later
+	mux.Handle("PATCH /api/chirps/{chirpID}", apiCfg.requireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiCfg.handlerEditChirp)))
+	// Previous bodies of an edited chirp
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.handlerGetChirpRevisions)
+	// The conversation a chirp is part of
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerGetThread)
+	mux.Handle("GET /api/chirps/scheduled", apiCfg.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiCfg.handlerGetScheduledChirps)))
+	mux.Handle("DELETE /api/chirps/scheduled/{scheduledChirpID}", apiCfg.requireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiCfg.handlerDeleteScheduledChirp)))
 	// Add a POST /api/login endpoint.
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	// Users with 2FA finish the login with a code
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	// Passwordless login with a sign-in link sent by email
+	mux.HandleFunc("POST /api/login/magic", apiCfg.handlerRequestMagicLink)
+	mux.HandleFunc("GET /api/login/magic/redeem", apiCfg.handlerRedeemMagicLink)
+	mux.HandleFunc("POST /api/login/magic/redeem", apiCfg.handlerRedeemMagicLink)
+	// Login with the external OpenID Connect provider
+	if apiCfg.oidcProvider != nil {
+		mux.HandleFunc("GET /api/login/oidc", apiCfg.handlerLoginOIDC)
+		mux.HandleFunc("GET /api/login/oidc/callback", apiCfg.handlerLoginOIDCCallback)
+	}
+	mux.Handle("GET /api/identities", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerGetIdentities)))
+	mux.Handle("POST /api/2fa/enroll", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerEnrollTOTP)))
+	mux.Handle("POST /api/2fa/confirm", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerConfirmTOTP)))
 	// Create a POST /api/refresh endpoint.
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	// Create a new POST /api/revoke endpoint.
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.Handle("POST /api/logout", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerLogout)))
 	// Add a PUT /api/users endpoint
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerEditUser)
+	mux.Handle("PUT /api/users", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerEditUser)))
 	// Add a new DELETE /api/chirps/{chirpID} route to your server
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.requireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiCfg.handlerDeleteChirp)))
 	// Add a POST /api/polka/webhooks endpoint.
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhookRedChirpy)
+	// Emails are verified with the link sent to them
+	mux.HandleFunc("GET /api/verify-email", apiCfg.handlerVerifyEmail)
+	mux.Handle("POST /api/verify-email/resend", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerResendEmailVerification)))
+	// Forgotten passwords are reset with a token sent by email
+	mux.HandleFunc("POST /api/password-reset", apiCfg.handlerRequestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.handlerConfirmPasswordReset)
+	// Personal access tokens for scripts and bots
+	mux.Handle("POST /api/tokens", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerCreateToken)))
+	mux.Handle("GET /api/tokens", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerGetTokens)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerRevokeToken)))
+	// Third-party apps are registered as OAuth clients
+	mux.Handle("POST /api/oauth/clients", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerCreateOAuthClient)))
+	mux.Handle("GET /api/oauth/clients", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerGetOAuthClients)))
+	mux.Handle("DELETE /api/oauth/clients/{clientID}", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerDeleteOAuthClient)))
+	// OAuth 2.0 authorization server (authorization code grant with PKCE)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.handlerOAuthConsent)
+	mux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.handlerOAuthRevoke)
+	// Users can list their sessions and log them out
+	mux.Handle("GET /api/sessions", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerGetSessions)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerRevokeSession)))
+	mux.Handle("DELETE /api/sessions", apiCfg.middlewareAuth(http.HandlerFunc(apiCfg.handlerRevokeAllSessions)))
+	// Publish the public JWT keys so other services can verify access tokens.
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 	// http.HandleFunc("/form", formHandler)
 	// http.HandleFunc("/hello", helloHandler)
 
+	// Pick up the access tokens revoked by other instances
+	go apiCfg.runDenylistSync(context.Background())
+	// End the Chirpy Red subscriptions whose period ended
+	go apiCfg.runSubscriptionExpiry(context.Background())
+	// Post the scheduled chirps when they are due
+	go apiCfg.runScheduledChirps(context.Background())
+
 	fmt.Printf("Starting Server at port %s\n", port)
 
 	// Create a new http.Server struct
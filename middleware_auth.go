@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+)
+
+type contextKey string
+
+// The authenticated user and the claims of its access token
+// are stored in the request context under these keys
+const (
+	userContextKey   contextKey = "user"
+	claimsContextKey contextKey = "claims"
+)
+
+// middlewareAuth wraps handlers of authenticated routes.
+// It validates the access token once, loads the user
+// and stores it in the request context,
+// so handlers never repeat the GetBearerToken + ValidateJWT dance.
+// Scoped tokens (personal access tokens) are refused,
+// routes that accept them are wrapped with requireScope instead.
+func (cfg *apiConfig) middlewareAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, claims, err := cfg.authenticate(r)
+		if err != nil {
+			// If the access token is malformed, missing or invalid,
+			// respond with a 401 status code.
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+		if claims.Scoped() {
+			respondWithError(w, http.StatusForbidden, "Scoped tokens can't be used for this route", nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithUser(r.Context(), user, claims)))
+	})
+}
+
+// requireScope wraps handlers of authenticated routes
+// that scoped tokens (personal access tokens) with the scope may use too.
+func (cfg *apiConfig) requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, claims, err := cfg.authenticate(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+		if !claims.HasScope(scope) {
+			respondWithError(w, http.StatusForbidden, "Missing scope "+scope, nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithUser(r.Context(), user, claims)))
+	})
+}
+
+// middlewareOptionalAuth is like middlewareAuth
+// but lets anonymous requests (no Authorization header) through.
+// A token that is present but invalid is still rejected.
+func (cfg *apiConfig) middlewareOptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, claims, err := cfg.authenticate(r)
+		if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithUser(r.Context(), user, claims)))
+	})
+}
+
+// requireRole wraps handlers of routes
+// that only users with the role (in their access token) may use.
+func (cfg *apiConfig) requireRole(role string, next http.Handler) http.Handler {
+	return cfg.middlewareAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+		if !claims.HasRole(role) {
+			respondWithError(w, http.StatusForbidden, "Missing role "+role, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// authenticate validates the bearer token of the request
+// (an access JWT or a personal access token)
+// and loads the user it was issued for.
+func (cfg *apiConfig) authenticate(r *http.Request) (database.User, *auth.Claims, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return database.User{}, nil, err
+	}
+
+	isPersonalAccessToken := auth.IsPersonalAccessToken(token)
+	var claims *auth.Claims
+	if isPersonalAccessToken {
+		claims, err = cfg.personalAccessTokenClaims(r.Context(), token)
+	} else {
+		claims, err = cfg.jwtKeys.ParseJWT(token)
+	}
+	if err != nil {
+		return database.User{}, nil, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return database.User{}, nil, err
+	}
+	user, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return database.User{}, nil, err
+	}
+
+	// Personal access tokens are revoked in the database,
+	// access JWTs with their token version or jti
+	if !isPersonalAccessToken {
+		err = cfg.checkAccessTokenRevoked(claims, user)
+		if err != nil {
+			return database.User{}, nil, err
+		}
+	}
+	return user, claims, nil
+}
+
+// personalAccessTokenClaims looks up a personal access token
+// and returns the claims it stands for: its user and scopes, never roles.
+func (cfg *apiConfig) personalAccessTokenClaims(ctx context.Context, token string) (*auth.Claims, error) {
+	pat, err := cfg.DB.UsePersonalAccessToken(ctx, auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("personal access token is invalid, expired or revoked")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &auth.Claims{Scopes: []string{}}
+	claims.Subject = pat.UserID.String()
+	claims.Scopes = append(claims.Scopes, pat.Scopes...)
+	return claims, nil
+}
+
+func contextWithUser(ctx context.Context, user database.User, claims *auth.Claims) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, user)
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// userFromContext returns the user stored by middlewareAuth
+// (or middlewareOptionalAuth).
+// ok is false for anonymous requests.
+func userFromContext(ctx context.Context) (user database.User, ok bool) {
+	user, ok = ctx.Value(userContextKey).(database.User)
+	return user, ok
+}
+
+// claimsFromContext returns the access token claims
+// stored by middlewareAuth (or middlewareOptionalAuth).
+// ok is false for anonymous requests.
+func claimsFromContext(ctx context.Context) (claims *auth.Claims, ok bool) {
+	claims, ok = ctx.Value(claimsContextKey).(*auth.Claims)
+	return claims, ok
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/thread"
 	"github.com/google/uuid"
 )
 
@@ -15,7 +18,13 @@ type User struct {
 	// Do NOT return the hashed password in the response
 	HashedPassword string `json:"-"`
 	// APIKey    string    `json:"api_key"`
-	IsChirpyRed bool `json:"is_chirpy_red"`
+	IsChirpyRed bool     `json:"is_chirpy_red"`
+	Roles       []string `json:"roles"`
+	// nil until the email is verified
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// New email waiting for verification
+	PendingEmail     string `json:"pending_email,omitempty"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
 }
 
 func databaseUserToUser(dbUser database.User) User {
@@ -26,16 +35,41 @@ func databaseUserToUser(dbUser database.User) User {
 		Email:     dbUser.Email,
 		// HashedPassword: dbUser.HashedPassword,
 		// APIKey:    dbUser.ApiKey,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		IsChirpyRed:      dbUser.IsChirpyRed,
+		Roles:            dbUser.Roles,
+		EmailVerifiedAt:  nullTimeToPtr(dbUser.EmailVerifiedAt),
+		PendingEmail:     dbUser.PendingEmail.String,
+		TwoFactorEnabled: dbUser.TotpEnabledAt.Valid,
 	}
 }
 
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	// URL of the image or video of the chirp, nil if it has none
+	MediaURL *string `json:"media_url"`
+	// Whether the body was edited, its revisions are at GET /api/chirps/{chirpID}/revisions
+	Edited   bool       `json:"edited"`
+	EditedAt *time.Time `json:"edited_at"`
+	// The chirp it replies to, nil for the first chirp of a conversation
+	// (or if the parent was deleted)
+	ParentID *uuid.UUID `json:"parent_id"`
+	// Whether it replied to a chirp that was deleted since
+	ParentDeleted bool `json:"parent_deleted"`
+	// First chirp of the conversation, GET /api/chirps/{chirpID}/thread returns all of it
+	RootID     uuid.UUID `json:"root_id"`
+	Depth      int32     `json:"depth"`
+	ReplyCount int32     `json:"reply_count"`
 }
 
 func databaseChirpToChirp(dbChirp database.Chirp) Chirp {
@@ -45,34 +79,344 @@ func databaseChirpToChirp(dbChirp database.Chirp) Chirp {
 		UpdatedAt: dbChirp.UpdatedAt,
 		Body:      dbChirp.Body,
 		UserID:    dbChirp.UserID,
+		MediaURL:  nullStringToPtr(dbChirp.MediaUrl),
+		Edited:    dbChirp.EditedAt.Valid,
+		EditedAt:  nullTimeToPtr(dbChirp.EditedAt),
+
+		ParentID:      nullUUIDToPtr(dbChirp.ParentID),
+		ParentDeleted: dbChirp.Depth > 0 && !dbChirp.ParentID.Valid,
+		RootID:        dbChirp.RootID,
+		Depth:         dbChirp.Depth,
+		ReplyCount:    dbChirp.ReplyCount,
 	}
 }
 
-func databaseChirpsToChirps(dbChirps []database.Chirp) []Chirp {
+func nullStringToPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullUUIDToPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func databaseChirpsToChirps(rows []database.ListChirpsRow) []Chirp {
 	chirps := []Chirp{}
-	for _, dbChirp := range dbChirps {
-		chirps = append(chirps, databaseChirpToChirp(dbChirp))
+	for _, row := range rows {
+		chirps = append(chirps, Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			MediaURL:  nullStringToPtr(row.MediaUrl),
+			Edited:    row.EditedAt.Valid,
+			EditedAt:  nullTimeToPtr(row.EditedAt),
+
+			ParentID:      nullUUIDToPtr(row.ParentID),
+			ParentDeleted: row.Depth > 0 && !row.ParentID.Valid,
+			RootID:        row.RootID,
+			Depth:         row.Depth,
+			ReplyCount:    row.ReplyCount,
+		})
 	}
 
 	return chirps
 }
 
-type RefreshToken struct {
-	Token     string    `json:"token"`
+// ChirpsPage is a page of chirps with the cursors of the pages around it
+type ChirpsPage struct {
+	Chirps []Chirp `json:"chirps"`
+	// Empty on the last page
+	Next string `json:"next"`
+	// Empty on the first page
+	Prev string `json:"prev"`
+}
+
+// ThreadChirp is a chirp of a conversation with the replies to it
+type ThreadChirp struct {
+	Chirp
+	Replies []ThreadChirp `json:"replies"`
+}
+
+// ThreadPage is a page of the replies of a conversation, as trees.
+// Replies whose parent isn't in the page (deleted, or on a previous page)
+// are at the top of Replies.
+type ThreadPage struct {
+	// nil if the first chirp of the conversation was deleted
+	Root    *Chirp        `json:"root"`
+	Replies []ThreadChirp `json:"replies"`
+	Next    string        `json:"next"`
+	Prev    string        `json:"prev"`
+}
+
+func threadNodesToThreadChirps(nodes []*thread.Node[database.GetThreadChirpsRow]) []ThreadChirp {
+	chirps := []ThreadChirp{}
+	for _, node := range nodes {
+		row := node.Item
+		chirps = append(chirps, ThreadChirp{
+			Chirp: Chirp{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+				Body:      row.Body,
+				UserID:    row.UserID,
+				MediaURL:  nullStringToPtr(row.MediaUrl),
+				Edited:    row.EditedAt.Valid,
+				EditedAt:  nullTimeToPtr(row.EditedAt),
+
+				ParentID:      nullUUIDToPtr(row.ParentID),
+				ParentDeleted: row.Depth > 0 && !row.ParentID.Valid,
+				RootID:        row.RootID,
+				Depth:         row.Depth,
+				ReplyCount:    row.ReplyCount,
+			},
+			Replies: threadNodesToThreadChirps(node.Replies),
+		})
+	}
+	return chirps
+}
+
+// ChirpRevision is a previous body of an edited chirp
+type ChirpRevision struct {
+	ID      uuid.UUID `json:"id"`
+	ChirpID uuid.UUID `json:"chirp_id"`
+	Body    string    `json:"body"`
+	// When the body was written
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	// When it was replaced by an edit
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func databaseChirpRevisionToChirpRevision(dbRevision database.ChirpRevision) ChirpRevision {
+	return ChirpRevision{
+		ID:         dbRevision.ID,
+		ChirpID:    dbRevision.ChirpID,
+		Body:       dbRevision.Body,
+		CreatedAt:  dbRevision.CreatedAt,
+		ReplacedAt: dbRevision.ReplacedAt,
+	}
+}
+
+// SearchResult is a chirp matching a search
+type SearchResult struct {
+	Chirp Chirp   `json:"chirp"`
+	Rank  float32 `json:"rank"`
+	// HTML excerpt of the body with the matches in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+func databaseSearchRowToSearchResult(row database.SearchChirpsRow) SearchResult {
+	return SearchResult{
+		Chirp: Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			MediaURL:  nullStringToPtr(row.MediaUrl),
+			Edited:    row.EditedAt.Valid,
+			EditedAt:  nullTimeToPtr(row.EditedAt),
+
+			ParentID:      nullUUIDToPtr(row.ParentID),
+			ParentDeleted: row.Depth > 0 && !row.ParentID.Valid,
+			RootID:        row.RootID,
+			Depth:         row.Depth,
+			ReplyCount:    row.ReplyCount,
+		},
+		Rank:    row.Rank,
+		Snippet: row.Snippet,
+	}
+}
+
+// SearchResultsPage is a page of search results with the cursors of the pages around it
+type SearchResultsPage struct {
+	Results []SearchResult `json:"results"`
+	Next    string         `json:"next"`
+	Prev    string         `json:"prev"`
+}
+
+type ScheduledChirp struct {
+	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id"`
-	ExpiresAt time.Time `json:"expires_at"`
-	RevokedAt time.Time `json:"revoked_at"`
+	Body      string    `json:"body"`
+	MediaURL  *string   `json:"media_url"`
+	PublishAt time.Time `json:"publish_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func databaseScheduledChirpToScheduledChirp(dbChirp database.ScheduledChirp) ScheduledChirp {
+	return ScheduledChirp{
+		ID:        dbChirp.ID,
+		UserID:    dbChirp.UserID,
+		Body:      dbChirp.Body,
+		MediaURL:  nullStringToPtr(dbChirp.MediaUrl),
+		PublishAt: dbChirp.PublishAt,
+		CreatedAt: dbChirp.CreatedAt,
+	}
+}
+
+type RefreshToken struct {
+	TokenPrefix string    `json:"token_prefix"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uuid.UUID `json:"user_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	RevokedAt   time.Time `json:"revoked_at"`
+	FamilyID    uuid.UUID `json:"family_id"`
 }
 
 func databaseRefreshTokenToRefreshToken(dbRefreshToken database.RefreshToken) RefreshToken {
 	return RefreshToken{
-		Token:     dbRefreshToken.Token,
-		CreatedAt: dbRefreshToken.CreatedAt,
-		UpdatedAt: dbRefreshToken.UpdatedAt,
-		UserID:    dbRefreshToken.UserID,
-		ExpiresAt: dbRefreshToken.ExpiresAt,
-		RevokedAt: dbRefreshToken.RevokedAt.Time,
+		TokenPrefix: dbRefreshToken.TokenPrefix,
+		CreatedAt:   dbRefreshToken.CreatedAt,
+		UpdatedAt:   dbRefreshToken.UpdatedAt,
+		UserID:      dbRefreshToken.UserID,
+		ExpiresAt:   dbRefreshToken.ExpiresAt,
+		RevokedAt:   dbRefreshToken.RevokedAt.Time,
+		FamilyID:    dbRefreshToken.FamilyID,
+	}
+}
+
+// Session is a token family:
+// the refresh token issued at login and all tokens rotated from it.
+type Session struct {
+	ID          uuid.UUID `json:"id"`
+	TokenPrefix string    `json:"token_prefix"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	StartedAt   time.Time `json:"started_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func databaseSessionsToSessions(dbSessions []database.GetActiveSessionsRow) []Session {
+	sessions := []Session{}
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:          dbSession.FamilyID,
+			TokenPrefix: dbSession.TokenPrefix,
+			UserAgent:   dbSession.UserAgent,
+			IP:          dbSession.Ip,
+			StartedAt:   dbSession.StartedAt,
+			LastUsedAt:  dbSession.LastUsedAt,
+			ExpiresAt:   dbSession.ExpiresAt,
+		})
+	}
+
+	return sessions
+}
+
+type PersonalAccessToken struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+func databasePersonalAccessTokenToPersonalAccessToken(dbToken database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:          dbToken.ID,
+		Name:        dbToken.Name,
+		TokenPrefix: dbToken.TokenPrefix,
+		Scopes:      dbToken.Scopes,
+		CreatedAt:   dbToken.CreatedAt,
+		ExpiresAt:   nullTimeToPtr(dbToken.ExpiresAt),
+		LastUsedAt:  nullTimeToPtr(dbToken.LastUsedAt),
+	}
+}
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func databaseOAuthClientToOAuthClient(dbClient database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           dbClient.ID,
+		Name:         dbClient.Name,
+		RedirectURIs: dbClient.RedirectUris,
+		Confidential: dbClient.SecretHash.Valid,
+		CreatedAt:    dbClient.CreatedAt,
+	}
+}
+
+type Identity struct {
+	ID          uuid.UUID `json:"id"`
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func databaseIdentityToIdentity(dbIdentity database.UserIdentity) Identity {
+	return Identity{
+		ID:          dbIdentity.ID,
+		Issuer:      dbIdentity.Issuer,
+		Subject:     dbIdentity.Subject,
+		Email:       dbIdentity.Email,
+		CreatedAt:   dbIdentity.CreatedAt,
+		LastLoginAt: dbIdentity.LastLoginAt,
+	}
+}
+
+type Subscription struct {
+	UserID             uuid.UUID `json:"user_id"`
+	Plan               string    `json:"plan"`
+	Status             string    `json:"status"`
+	CurrentPeriodStart time.Time `json:"current_period_start"`
+	// nil for a subscription without an end
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	CanceledAt       *time.Time `json:"canceled_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func databaseSubscriptionToSubscription(dbSubscription database.Subscription) Subscription {
+	return Subscription{
+		UserID:             dbSubscription.UserID,
+		Plan:               dbSubscription.Plan,
+		Status:             dbSubscription.Status,
+		CurrentPeriodStart: dbSubscription.CurrentPeriodStart,
+		CurrentPeriodEnd:   nullTimeToPtr(dbSubscription.CurrentPeriodEnd),
+		CanceledAt:         nullTimeToPtr(dbSubscription.CanceledAt),
+		UpdatedAt:          dbSubscription.UpdatedAt,
+	}
+}
+
+type SubscriptionEvent struct {
+	ID               uuid.UUID       `json:"id"`
+	UserID           uuid.UUID       `json:"user_id"`
+	Event            string          `json:"event"`
+	Source           string          `json:"source"`
+	WebhookEventID   string          `json:"webhook_event_id,omitempty"`
+	Status           string          `json:"status"`
+	CurrentPeriodEnd *time.Time      `json:"current_period_end"`
+	Payload          json.RawMessage `json:"payload"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+func databaseSubscriptionEventToSubscriptionEvent(dbEvent database.SubscriptionEvent) SubscriptionEvent {
+	return SubscriptionEvent{
+		ID:               dbEvent.ID,
+		UserID:           dbEvent.UserID,
+		Event:            dbEvent.Event,
+		Source:           dbEvent.Source,
+		WebhookEventID:   dbEvent.WebhookEventID.String,
+		Status:           dbEvent.Status,
+		CurrentPeriodEnd: nullTimeToPtr(dbEvent.CurrentPeriodEnd),
+		Payload:          dbEvent.Payload,
+		CreatedAt:        dbEvent.CreatedAt,
 	}
 }
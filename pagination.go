@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Bayan2019/go-http-server/internal/pagination"
+)
+
+// encodeCursor returns the opaque form of the cursor, empty for nil.
+func encodeCursor(cursor *pagination.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return cursor.Encode()
+}
+
+// setPageLinks sets the Link header (RFC 8288) of a page
+// to the URLs of the next and previous pages
+// (their cursors are empty if there is no such page).
+func setPageLinks(w http.ResponseWriter, r *http.Request, next, prev string) {
+	links := []string{}
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, next)))
+	}
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, prev)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageURL returns the URL of the request with the cursor of another page.
+func pageURL(r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	return r.URL.Path + "?" + query.Encode()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/auth"
+	"github.com/Bayan2019/go-http-server/internal/database"
+)
+
+// Access tokens are revoked in two ways:
+//   - all tokens of a user, by bumping users.token_version
+//     (password change, "log out everywhere")
+//   - a single token, by listing its jti in revoked_access_tokens (log out)
+//
+// The revoked jtis are cached in memory (cfg.denylist)
+// and synced from the database, so other instances pick them up.
+
+// How often the denylist is synced from the database
+const denylistSyncInterval = 30 * time.Second
+
+var errAccessTokenRevoked = errors.New("access token was revoked")
+
+// checkAccessTokenRevoked returns an error if the access token was revoked.
+// The user is the one the token was issued for.
+func (cfg *apiConfig) checkAccessTokenRevoked(claims *auth.Claims, user database.User) error {
+	if claims.TokenVersion != user.TokenVersion {
+		return errAccessTokenRevoked
+	}
+	if cfg.denylist.Contains(claims.ID) {
+		return errAccessTokenRevoked
+	}
+	return nil
+}
+
+// revokeAccessToken revokes a single access token until it expires.
+func (cfg *apiConfig) revokeAccessToken(ctx context.Context, claims *auth.Claims, user database.User) error {
+	err := cfg.DB.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{
+		Jti:       claims.ID,
+		UserID:    user.ID,
+		ExpiresAt: claims.ExpiresAt.Time.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	cfg.denylist.Add(claims.ID, claims.ExpiresAt.Time)
+	return nil
+}
+
+// runDenylistSync loads the revoked access tokens into the denylist
+// and keeps it in sync until the context is done.
+func (cfg *apiConfig) runDenylistSync(ctx context.Context) {
+	since := time.Time{}
+	ticker := time.NewTicker(denylistSyncInterval)
+	defer ticker.Stop()
+	for {
+		syncedAt := time.Now().UTC()
+		err := cfg.syncDenylist(ctx, since)
+		if err != nil {
+			log.Printf("Couldn't sync revoked access tokens: %s", err)
+		} else {
+			// The window overlaps the previous one,
+			// so clock skew with the database doesn't lose revocations
+			since = syncedAt.Add(-denylistSyncInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) syncDenylist(ctx context.Context, since time.Time) error {
+	revoked, err := cfg.DB.GetRevokedAccessTokens(ctx, since)
+	if err != nil {
+		return err
+	}
+	for _, token := range revoked {
+		cfg.denylist.Add(token.Jti, token.ExpiresAt)
+	}
+
+	// Expired tokens don't need to be listed anymore
+	cfg.denylist.Prune(time.Now())
+	return cfg.DB.DeleteExpiredRevokedAccessTokens(ctx)
+}
@@ -0,0 +1,5 @@
+-- name: GetChirpRevisions :many
+-- Newest first
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
\ No newline at end of file
@@ -1,29 +1,108 @@
 -- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
-VALUES (
-    gen_random_uuid(), 
-    NOW(), NOW(), $1, $2
-    -- encode(sha256(random()::text::bytea), 'hex')
+-- A reply (with a parent_id) joins the conversation of its parent
+-- and is counted in the parent's replies.
+-- If the parent doesn't exist (e.g. it was just deleted), nothing is inserted.
+WITH parent AS (
+    UPDATE chirps
+    SET reply_count = reply_count + 1
+    WHERE chirps.id = sqlc.narg('parent_id')
+    RETURNING chirps.id, chirps.root_id, chirps.depth
 )
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, media_url, parent_id, root_id, depth)
+SELECT
+    new_chirp.id,
+    NOW(), NOW(), sqlc.arg('body')::text, sqlc.arg('user_id')::uuid, sqlc.narg('media_url')::text,
+    -- encode(sha256(random()::text::bytea), 'hex')
+    parent.id, COALESCE(parent.root_id, new_chirp.id), COALESCE(parent.depth + 1, 0)
+FROM (SELECT gen_random_uuid() AS id) AS new_chirp
+LEFT JOIN parent ON TRUE
+WHERE sqlc.narg('parent_id')::uuid IS NULL OR parent.id IS NOT NULL
 RETURNING *;
 
--- name: GetChirpsAsc :many
-SELECT * FROM chirps ORDER BY created_at ASC;
--- name: GetChirpsDesc :many
-SELECT * FROM chirps ORDER BY created_at DESC;
-
 -- name: GetChirp :one
 SELECT * FROM chirps WHERE id = $1;
 
 -- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id=$1;
+-- The parent counts one reply less,
+-- the replies of the chirp lose their parent (but stay in the conversation)
+WITH deleted AS (
+    DELETE FROM chirps WHERE chirps.id = $1
+    RETURNING chirps.parent_id
+)
+UPDATE chirps
+SET reply_count = reply_count - 1
+WHERE chirps.id IN (SELECT parent_id FROM deleted);
 
--- name: GetChirpsByAuthorAsc :many
-SELECT * FROM chirps
-WHERE user_id=$1
-ORDER BY created_at ASC;
+-- name: ListChirps :many
+-- A page of chirps ordered by (created_at, id), with optional filters.
+-- Without a cursor it starts at the beginning of the order,
+-- otherwise right after the cursor.
+SELECT
+    -- Not search_vector, which pages of chirps don't need
+    id, created_at, updated_at, body, user_id, media_url, edited_at, parent_id, root_id, depth, reply_count
+FROM chirps
+WHERE (COALESCE(cardinality(sqlc.arg('author_ids')::uuid[]), 0) = 0 OR user_id = ANY(sqlc.arg('author_ids')::uuid[]))
+AND (sqlc.narg('created_after')::timestamp IS NULL OR created_at >= sqlc.narg('created_after'))
+AND (sqlc.narg('created_before')::timestamp IS NULL OR created_at < sqlc.narg('created_before'))
+-- An ILIKE pattern, escaped with backslashes
+AND (sqlc.narg('body_pattern')::text IS NULL OR body ILIKE sqlc.narg('body_pattern'))
+AND (NOT sqlc.arg('red_authors_only')::bool OR user_id IN (SELECT id FROM users WHERE is_chirpy_red))
+AND (sqlc.narg('is_reply')::bool IS NULL OR (depth > 0) = sqlc.narg('is_reply'))
+AND (sqlc.narg('has_media')::bool IS NULL OR (media_url IS NOT NULL) = sqlc.narg('has_media'))
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (sqlc.arg('descending')::bool
+        AND (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+    OR (NOT sqlc.arg('descending')::bool
+        AND (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+)
+ORDER BY
+    CASE WHEN sqlc.arg('descending')::bool THEN created_at END DESC,
+    CASE WHEN sqlc.arg('descending')::bool THEN id END DESC,
+    created_at ASC,
+    id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: EditChirp :one
+-- Replaces the body, keeping the previous one as a revision.
+-- The row is locked first: a concurrent edit is waited for,
+-- and the body it wrote is the one kept (not the statement's snapshot).
+WITH locked AS (
+    SELECT chirps.id, chirps.body, COALESCE(chirps.edited_at, chirps.created_at) AS written_at
+    FROM chirps
+    WHERE chirps.id = $1
+    FOR UPDATE
+), revision AS (
+    INSERT INTO chirp_revisions(id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), locked.id, locked.body, locked.written_at, NOW()
+    FROM locked
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW(), edited_at = NOW()
+FROM locked
+WHERE chirps.id = locked.id
+RETURNING chirps.*;
 
--- name: GetChirpsByAuthorDesc :many
-SELECT * FROM chirps
-WHERE user_id=$1
-ORDER BY created_at DESC;
\ No newline at end of file
+-- name: GetThreadChirps :many
+-- A page of the replies of a conversation ordered by (created_at, id),
+-- down to a depth, like ListChirps.
+SELECT
+    -- Not search_vector, which pages of chirps don't need
+    id, created_at, updated_at, body, user_id, media_url, edited_at, parent_id, root_id, depth, reply_count
+FROM chirps
+WHERE root_id = sqlc.arg('root_id')
+AND id <> sqlc.arg('root_id')
+AND depth <= sqlc.arg('max_depth')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (sqlc.arg('descending')::bool
+        AND (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+    OR (NOT sqlc.arg('descending')::bool
+        AND (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+)
+ORDER BY
+    CASE WHEN sqlc.arg('descending')::bool THEN created_at END DESC,
+    CASE WHEN sqlc.arg('descending')::bool THEN id END DESC,
+    created_at ASC,
+    id ASC
+LIMIT sqlc.arg('limit');
\ No newline at end of file
@@ -0,0 +1,39 @@
+-- name: TakeLoginAttempt :one
+-- Counts a login attempt for the key, unless logins are locked
+-- (then the row is returned as it is, with its locked_until).
+-- Attempts older than an hour don't count anymore.
+-- The upsert locks the row until the end of the transaction,
+-- so concurrent attempts are counted one after the other.
+INSERT INTO login_throttles(key, failed_attempts, locked_until, updated_at)
+VALUES ($1, 1, NULL, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failed_attempts = CASE
+        WHEN login_throttles.locked_until > NOW() THEN login_throttles.failed_attempts
+        WHEN login_throttles.updated_at < NOW() - INTERVAL '1 hour' THEN 1
+        ELSE login_throttles.failed_attempts + 1
+    END,
+    updated_at = CASE
+        WHEN login_throttles.locked_until > NOW() THEN login_throttles.updated_at
+        ELSE NOW()
+    END
+RETURNING *;
+
+-- name: ForgiveLoginAttempt :exec
+-- Uncounts an attempt that turned out right,
+-- unlocking the key if it's back under the threshold.
+UPDATE login_throttles
+SET failed_attempts = GREATEST(failed_attempts - 1, 0),
+    locked_until = CASE
+        WHEN failed_attempts - 1 < sqlc.arg('threshold')::int THEN NULL
+        ELSE locked_until
+    END
+WHERE key = sqlc.arg('key');
+
+-- name: LockLogin :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: ResetLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- name: CreateMagicLinkToken :one
+INSERT INTO magic_link_tokens(token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+    $1, $2,
+    NOW(), NOW() + INTERVAL '15 minutes', NULL
+)
+RETURNING *;
+
+-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO oauth_refresh_tokens(token_hash, client_id, user_id, scopes, created_at, expires_at, revoked_at)
+VALUES (
+    $1, $2, $3, $4,
+    NOW(), NOW() + INTERVAL '60 days', NULL
+)
+RETURNING *;
+
+-- name: RotateOAuthRefreshToken :one
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1
+AND client_id = $2
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeOAuthRefreshToken :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1
+AND client_id = $2
+AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens(token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+    $1, $2,
+    NOW(), NOW() + INTERVAL '1 hour', NULL
+)
+RETURNING *;
+
+-- name: GetPasswordResetToken :one
+-- A token that can still be used, without using it
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW();
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeletePasswordResetTokens :exec
+DELETE FROM password_reset_tokens
+WHERE user_id = $1;
\ No newline at end of file
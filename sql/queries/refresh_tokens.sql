@@ -1,25 +1,66 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens(token_hash, token_prefix, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at)
 VALUES (
-    $1, 
-    NOW(), NOW(), $2, 
-    NOW()+ INTERVAL '60 days', NULL
+    $1, $2,
+    NOW(), NOW(), $3, 
+    NOW()+ INTERVAL '60 days', NULL, $4,
+    $5, $6, NOW()
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
 
 -- name: GetUserFromRefreshToken :one
 SELECT users.* FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 AND revoked_at IS NULL
 AND expires_at > NOW();
 
 -- name: RevokeToken :one
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1
-RETURNING *;
\ No newline at end of file
+WHERE token_hash = $1
+RETURNING *;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE token_hash = $1
+AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL;
+
+-- name: GetActiveSessions :many
+SELECT refresh_tokens.family_id, refresh_tokens.token_prefix,
+    refresh_tokens.user_agent, refresh_tokens.ip,
+    refresh_tokens.last_used_at, refresh_tokens.expires_at,
+    (
+        SELECT MIN(family.created_at) FROM refresh_tokens family
+        WHERE family.family_id = refresh_tokens.family_id
+    )::TIMESTAMP AS started_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
+AND refresh_tokens.revoked_at IS NULL
+AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: RevokeAllSessions :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens(jti, user_id, revoked_at, expires_at)
+VALUES ($1, $2, NOW(), $3)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: GetRevokedAccessTokens :many
+-- Tokens revoked since the last sync that are still alive
+SELECT * FROM revoked_access_tokens
+WHERE revoked_at >= $1
+AND expires_at > NOW();
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at <= NOW();
\ No newline at end of file
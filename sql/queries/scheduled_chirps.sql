@@ -0,0 +1,36 @@
+-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps(id, user_id, body, media_url, publish_at, created_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW()
+)
+RETURNING *;
+
+-- name: GetScheduledChirps :many
+SELECT * FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at ASC;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- name: PublishDueScheduledChirps :execrows
+-- Moves the due chirps to chirps in one statement:
+-- each is posted once, even with several instances running the job,
+-- and stays scheduled if posting it fails.
+-- A posted chirp keeps the id it had while scheduled.
+WITH due AS (
+    DELETE FROM scheduled_chirps
+    WHERE publish_at <= NOW()
+    RETURNING scheduled_chirps.id, scheduled_chirps.user_id, scheduled_chirps.body, scheduled_chirps.media_url
+)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, media_url, parent_id, root_id, depth)
+SELECT due.id, NOW(), NOW(), due.body, due.user_id, due.media_url, NULL, due.id, 0
+FROM due;
+
+-- name: CountRecentChirps :one
+-- Chirps posted and scheduled by the user since the time
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1 AND chirps.created_at > $2)
+    + (SELECT COUNT(*) FROM scheduled_chirps WHERE scheduled_chirps.user_id = $1 AND scheduled_chirps.created_at > $2)
+    AS count;
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- name: SearchChirps :many
+-- Chirps matching the tsquery, best ranked first.
+-- The snippet is HTML: the body is escaped and the matches are in <mark> tags.
+SELECT
+    id, created_at, updated_at, body, user_id, media_url, edited_at, parent_id, root_id, depth, reply_count,
+    ts_rank_cd(search_vector, to_tsquery('english', sqlc.arg('query')))::real AS rank,
+    ts_headline(
+        'english',
+        replace(replace(replace(body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        to_tsquery('english', sqlc.arg('query')),
+        'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2'
+    )::text AS snippet
+FROM chirps
+WHERE search_vector @@ to_tsquery('english', sqlc.arg('query'))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
\ No newline at end of file
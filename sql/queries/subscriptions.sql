@@ -0,0 +1,39 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: GetSubscriptionForUpdate :one
+-- Locks the subscription until the end of the transaction
+SELECT * FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions(user_id, plan, status, current_period_start, current_period_end, canceled_at, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    canceled_at = EXCLUDED.canceled_at,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetExpiredSubscriptions :many
+-- Subscriptions still granting perks whose period ended
+SELECT * FROM subscriptions
+WHERE status IN ('active', 'past_due', 'canceled')
+AND current_period_end <= NOW();
+
+-- name: CreateSubscriptionEvent :one
+INSERT INTO subscription_events(id, user_id, event, source, webhook_event_id, status, current_period_end, payload, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, NOW())
+RETURNING *;
+
+-- name: GetSubscriptionEvents :many
+-- Newest first, optionally of a single user
+SELECT * FROM subscription_events
+WHERE sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id')
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit');
\ No newline at end of file
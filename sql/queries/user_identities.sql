@@ -0,0 +1,34 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities(id, user_id, issuer, subject, email, created_at, last_login_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4,
+    NOW(), NOW()
+)
+RETURNING *;
+
+-- name: UseUserIdentity :one
+-- Returns the user linked to the identity
+UPDATE user_identities
+SET last_login_at = NOW(), email = $3
+WHERE issuer = $1
+AND subject = $2
+RETURNING user_id;
+
+-- name: GetUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CreateOIDCLoginState :one
+INSERT INTO oidc_login_states(state_hash, nonce, code_verifier, created_at, expires_at)
+VALUES (
+    $1, $2, $3,
+    NOW(), NOW() + INTERVAL '10 minutes'
+)
+RETURNING *;
+
+-- name: UseOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+AND expires_at > NOW()
+RETURNING *;
\ No newline at end of file
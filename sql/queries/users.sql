@@ -12,14 +12,87 @@ RETURNING *;
 SELECT * FROM users
 WHERE email = $1;
 
--- name: UpdateUser :one
+-- name: UpdateUserRed :one
 UPDATE users
-SET updated_at = NOW(), email=$2, hashed_password=$3
+SET updated_at = NOW(), is_chirpy_red=TRUE
 WHERE id = $1
 RETURNING *;
 
--- name: UpdateUserRed :one
+-- name: LockUser :one
+-- Locks the user until the end of the transaction
+-- (e.g. while their subscription, which may not exist yet, is changed)
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
+
+-- name: SetUserChirpyRed :one
+-- Synced with the user's subscription
 UPDATE users
-SET updated_at = NOW(), is_chirpy_red=TRUE
+SET updated_at = NOW(), is_chirpy_red = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+
+-- name: GetUsers :many
+SELECT * FROM users
+ORDER BY created_at ASC;
+
+-- name: UpdateUserRoles :one
+UPDATE users
+SET updated_at = NOW(), roles=$2
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET updated_at = NOW(), hashed_password=$2
+WHERE id = $1
+RETURNING *;
+
+-- name: BumpUserTokenVersion :one
+-- Revokes every access token of the user
+UPDATE users
+SET updated_at = NOW(), token_version = token_version + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserPendingEmail :one
+UPDATE users
+SET updated_at = NOW(), pending_email=$2
+WHERE id = $1
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+-- The verified email becomes the login email,
+-- whether it was the signup email or a pending one.
+UPDATE users
+SET updated_at = NOW(), email=$2, pending_email=NULL, email_verified_at=NOW()
+WHERE id = $1
+AND (email = $2 OR pending_email = $2)
+RETURNING *;
+
+-- name: SetUserTOTPSecret :one
+-- A new secret disables 2FA until it's confirmed
+UPDATE users
+SET updated_at = NOW(), totp_secret=$2, totp_enabled_at=NULL, totp_last_step=0
+WHERE id = $1
+RETURNING *;
+
+-- name: EnableUserTOTP :one
+UPDATE users
+SET updated_at = NOW(), totp_enabled_at=NOW(), totp_last_step=$2
+WHERE id = $1
+AND totp_secret IS NOT NULL
+RETURNING *;
+
+-- name: UseUserTOTPStep :one
+-- Fails if the step (or a later one) was already used
+UPDATE users
+SET totp_last_step=$2
 WHERE id = $1
+AND totp_last_step < $2
 RETURNING *;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- name: RecordWebhookEvent :execrows
+-- Returns 0 if the event was already recorded.
+-- It's recorded in the transaction that handles it,
+-- so an event that failed is handled again when Polka retries it.
+INSERT INTO webhook_events(id, event, received_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (id) DO NOTHING;
\ No newline at end of file
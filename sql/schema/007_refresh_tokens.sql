@@ -0,0 +1,21 @@
+-- +goose Up
+-- Refresh tokens are stored as a keyed hash (HMAC-SHA256) instead of plaintext,
+-- together with a short plaintext prefix to identify them.
+-- Existing rows are converted with the same key the server uses (REFRESH_TOKEN_KEY),
+-- so it must be passed to the migration, e.g.:
+-- PGOPTIONS="-c chirpy.refresh_token_key=$REFRESH_TOKEN_KEY" goose postgres <connection_string> up
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+ALTER TABLE refresh_tokens ADD COLUMN token_prefix TEXT NOT NULL DEFAULT '';
+UPDATE refresh_tokens
+SET token_prefix = left(token, 8),
+    token = encode(hmac(token, current_setting('chirpy.refresh_token_key'), 'sha256'), 'hex');
+ALTER TABLE refresh_tokens ALTER COLUMN token_prefix DROP DEFAULT;
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+CREATE UNIQUE INDEX refresh_tokens_token_hash_idx ON refresh_tokens(token_hash);
+
+-- +goose Down
+-- Hashed tokens can't be converted back, so they are all revoked.
+DROP INDEX refresh_tokens_token_hash_idx;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
+ALTER TABLE refresh_tokens DROP COLUMN token_prefix;
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE revoked_at IS NULL;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Failed login attempts per account ("email:<email>") and per client ("ip:<ip>")
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failed_attempts INT NOT NULL,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
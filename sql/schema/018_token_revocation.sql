@@ -0,0 +1,15 @@
+-- +goose Up
+-- Bumped to revoke every access token of the user
+ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0;
+
+-- Access tokens revoked one by one (by jti), kept until they expire
+CREATE TABLE revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    revoked_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
+ALTER TABLE users DROP COLUMN token_version;
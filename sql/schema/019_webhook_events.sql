@@ -0,0 +1,11 @@
+-- +goose Up
+-- Polka webhook events already handled, by their id:
+-- redeliveries and replays of an event are ignored
+CREATE TABLE webhook_events (
+    id TEXT PRIMARY KEY,
+    event TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,43 @@
+-- +goose Up
+-- The Chirpy Red subscription of each user, driven by Polka's events.
+-- users.is_chirpy_red is kept in sync with it.
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_start TIMESTAMP NOT NULL,
+    -- NULL for a subscription without an end
+    current_period_end TIMESTAMP,
+    canceled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions(current_period_end);
+
+-- The members from before subscriptions were tracked never expire
+INSERT INTO subscriptions(user_id, plan, status, current_period_start, created_at, updated_at)
+SELECT id, 'red', 'active', updated_at, NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- Ledger of every event applied to a subscription
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    -- 'polka' or 'system' (the expiry job)
+    source TEXT NOT NULL,
+    webhook_event_id TEXT,
+    -- The subscription after the event
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscription_events_user_id_idx ON subscription_events(user_id, created_at);
+
+-- +goose Down
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Chirps posted later (a Chirpy Red perk),
+-- moved to chirps by a background job when they are due
+CREATE TABLE scheduled_chirps (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    publish_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX scheduled_chirps_publish_at_idx ON scheduled_chirps(publish_at);
+CREATE INDEX scheduled_chirps_user_id_idx ON scheduled_chirps(user_id, created_at);
+
+-- Chirps posted by a user in the last hour are counted for the rate limit
+CREATE INDEX chirps_user_id_created_at_idx ON chirps(user_id, created_at);
+
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_idx;
+DROP TABLE scheduled_chirps;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Chirps are listed by pages ordered by (created_at, id)
+CREATE INDEX chirps_created_at_id_idx ON chirps(created_at, id);
+CREATE INDEX chirps_user_id_created_at_id_idx ON chirps(user_id, created_at, id);
+DROP INDEX chirps_user_id_created_at_idx;
+
+-- +goose Down
+CREATE INDEX chirps_user_id_created_at_idx ON chirps(user_id, created_at);
+DROP INDEX chirps_user_id_created_at_id_idx;
+DROP INDEX chirps_created_at_id_idx;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Full-text search over chirps.
+-- The generated column is computed for the existing chirps by the ALTER TABLE.
+ALTER TABLE chirps
+ADD COLUMN search_vector tsvector NOT NULL
+GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX chirps_search_vector_idx ON chirps USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX chirps_search_vector_idx;
+ALTER TABLE chirps DROP COLUMN search_vector;
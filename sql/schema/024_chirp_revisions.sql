@@ -0,0 +1,20 @@
+-- +goose Up
+-- When the chirp was last edited, NULL if it never was
+ALTER TABLE chirps ADD COLUMN edited_at TIMESTAMP;
+
+-- Every previous body of the edited chirps
+CREATE TABLE chirp_revisions (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    -- When the body was written
+    created_at TIMESTAMP NOT NULL,
+    -- When it was replaced by an edit
+    replaced_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions(chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
+ALTER TABLE chirps DROP COLUMN edited_at;
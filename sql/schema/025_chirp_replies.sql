@@ -0,0 +1,23 @@
+-- +goose Up
+-- Chirps can reply to other chirps.
+-- root_id is the first chirp of the conversation (the chirp itself for the others),
+-- depth the number of chirps above it.
+-- The replies of a deleted chirp stay in the conversation without a parent.
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN root_id UUID,
+ADD COLUMN depth INT NOT NULL DEFAULT 0,
+ADD COLUMN reply_count INT NOT NULL DEFAULT 0;
+
+UPDATE chirps SET root_id = id;
+ALTER TABLE chirps ALTER COLUMN root_id SET NOT NULL;
+
+CREATE INDEX chirps_root_id_created_at_id_idx ON chirps(root_id, created_at, id);
+CREATE INDEX chirps_parent_id_idx ON chirps(parent_id);
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN reply_count,
+DROP COLUMN depth,
+DROP COLUMN root_id,
+DROP COLUMN parent_id;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- URL of the image or video attached to the chirp, NULL if it has none
+ALTER TABLE chirps ADD COLUMN media_url TEXT;
+ALTER TABLE scheduled_chirps ADD COLUMN media_url TEXT;
+
+-- Pages of chirps with media (GET /api/chirps?has_media=true)
+CREATE INDEX chirps_media_created_at_id_idx ON chirps(created_at, id) WHERE media_url IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_media_created_at_id_idx;
+ALTER TABLE scheduled_chirps DROP COLUMN media_url;
+ALTER TABLE chirps DROP COLUMN media_url;
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+	"github.com/Bayan2019/go-http-server/internal/subscription"
+	"github.com/google/uuid"
+)
+
+// Chirpy Red is a subscription driven by Polka's webhook events
+// (upgrades, renewals, cancellations, refunds, failed payments...).
+// Every event is recorded in the subscription_events ledger,
+// and users.is_chirpy_red follows whether the subscription grants the perks.
+// Subscriptions whose period ended are expired by a background job.
+
+// Sources of the subscription events
+const (
+	subscriptionSourcePolka  = "polka"
+	subscriptionSourceSystem = "system"
+)
+
+// How often the subscriptions whose period ended are expired
+const subscriptionExpiryInterval = time.Minute
+
+// Events listed by GET /admin/subscription-events by default, and at most
+const (
+	defaultSubscriptionEventsLimit = 100
+	maxSubscriptionEventsLimit     = 1000
+)
+
+// subscriptionEvent is an event to apply to a user's subscription.
+type subscriptionEvent struct {
+	UserID uuid.UUID
+	Event  string
+	Source string
+	// Id of the Polka webhook event, empty for system events
+	WebhookEventID string
+	// End of the paid period sent with the event, zero if none
+	PeriodEnd time.Time
+	Payload   json.RawMessage
+}
+
+// applySubscriptionEvent applies the event to the user's subscription,
+// records it in the ledger and syncs the user's Chirpy Red membership.
+// q must run in a transaction (see withTx): the user and the subscription
+// stay locked until it ends, so concurrent events (e.g. a renewal and
+// the expiry job) are applied one after the other.
+// It returns subscription.ErrUnknownEvent for events it doesn't handle
+// and sql.ErrNoRows if the user doesn't exist.
+func applySubscriptionEvent(ctx context.Context, q *database.Queries, event subscriptionEvent) (database.Subscription, error) {
+	now := time.Now().UTC()
+
+	// The subscription may not exist yet, so the user is locked too
+	_, err := q.LockUser(ctx, event.UserID)
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	sub := subscription.Subscription{}
+	dbSubscription, err := q.GetSubscriptionForUpdate(ctx, event.UserID)
+	if err == nil {
+		sub = databaseSubscriptionToSubscriptionState(dbSubscription)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return database.Subscription{}, err
+	}
+
+	// The expiry job found the subscription before taking the lock:
+	// it may have been renewed since
+	if event.Event == subscription.EventExpired && !sub.Lapsed(now) {
+		return dbSubscription, nil
+	}
+
+	sub, err = subscription.Apply(sub, event.Event, event.PeriodEnd.UTC(), now)
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	_, err = q.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{
+		ID:          event.UserID,
+		IsChirpyRed: sub.Entitled(now),
+	})
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	dbSubscription, err = q.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:             event.UserID,
+		Plan:               sub.Plan,
+		Status:             string(sub.Status),
+		CurrentPeriodStart: sub.PeriodStart,
+		CurrentPeriodEnd:   timeToNullTime(sub.PeriodEnd),
+		CanceledAt:         timeToNullTime(sub.CanceledAt),
+	})
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	payload := event.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage(`{}`)
+	}
+	_, err = q.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		UserID: event.UserID,
+		Event:  event.Event,
+		Source: event.Source,
+		WebhookEventID: sql.NullString{
+			String: event.WebhookEventID,
+			Valid:  event.WebhookEventID != "",
+		},
+		Status:           dbSubscription.Status,
+		CurrentPeriodEnd: dbSubscription.CurrentPeriodEnd,
+		Payload:          payload,
+	})
+	if err != nil {
+		return database.Subscription{}, err
+	}
+	return dbSubscription, nil
+}
+
+// runSubscriptionExpiry expires the subscriptions whose period ended
+// until the context is done.
+func (cfg *apiConfig) runSubscriptionExpiry(ctx context.Context) {
+	ticker := time.NewTicker(subscriptionExpiryInterval)
+	defer ticker.Stop()
+	for {
+		err := cfg.expireSubscriptions(ctx)
+		if err != nil {
+			log.Printf("Couldn't expire subscriptions: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) error {
+	expired, err := cfg.DB.GetExpiredSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, dbSubscription := range expired {
+		err := cfg.withTx(ctx, func(q *database.Queries) error {
+			_, err := applySubscriptionEvent(ctx, q, subscriptionEvent{
+				UserID: dbSubscription.UserID,
+				Event:  subscription.EventExpired,
+				Source: subscriptionSourceSystem,
+			})
+			return err
+		})
+		if err != nil {
+			// The others are still expired, this one is retried next time
+			log.Printf("Couldn't expire subscription of user %s: %s", dbSubscription.UserID, err)
+		}
+	}
+	return nil
+}
+
+// GET /admin/subscription-events lists the subscription events, newest first.
+// ?user_id= keeps the events of a user, ?limit= sets how many are listed.
+func (cfg *apiConfig) handlerAdminGetSubscriptionEvents(w http.ResponseWriter, r *http.Request) {
+	params := database.GetSubscriptionEventsParams{
+		Limit: defaultSubscriptionEventsLimit,
+	}
+
+	if s := r.URL.Query().Get("user_id"); s != "" {
+		userID, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+			return
+		}
+		params.UserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxSubscriptionEventsLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	dbEvents, err := cfg.DB.GetSubscriptionEvents(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription events", err)
+		return
+	}
+
+	events := []SubscriptionEvent{}
+	for _, dbEvent := range dbEvents {
+		events = append(events, databaseSubscriptionEventToSubscriptionEvent(dbEvent))
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// GET /admin/users/{userID}/subscription returns the subscription of a user.
+func (cfg *apiConfig) handlerAdminGetUserSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	dbSubscription, err := cfg.DB.GetSubscription(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find subscription", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseSubscriptionToSubscription(dbSubscription))
+}
+
+func databaseSubscriptionToSubscriptionState(dbSubscription database.Subscription) subscription.Subscription {
+	return subscription.Subscription{
+		Plan:        dbSubscription.Plan,
+		Status:      subscription.Status(dbSubscription.Status),
+		PeriodStart: dbSubscription.CurrentPeriodStart,
+		PeriodEnd:   dbSubscription.CurrentPeriodEnd.Time,
+		CanceledAt:  dbSubscription.CanceledAt.Time,
+	}
+}
+
+func timeToNullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Bayan2019/go-http-server/internal/database"
+)
+
+// withTx runs fn with queries in a transaction,
+// committed if fn returns nil and rolled back otherwise.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// A no-op once committed
+	defer tx.Rollback()
+
+	err = fn(cfg.DB.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}